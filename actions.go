@@ -112,7 +112,8 @@ func (s *Server) startServer(foregroud bool) error {
 	// 直接启动
 	if foregroud {
 		log.Info("----------- start server -----------")
-		suv.AutoStartPrograms()
+		go suv.AutoStartPrograms()
+		go suv.runScheduler()
 		if s.UnixServer {
 			unixListener, err := net.Listen("unix", listenAddr)
 			if err != nil {
@@ -139,7 +140,7 @@ func (s *Server) startServer(foregroud bool) error {
 
 		// 写pidfile
 		if err := writePidFile(cmd.Process.Pid, s.PidFile); err != nil {
-			return fmt.Errorf("write pid file faild. ", s.PidFile, err)
+			return fmt.Errorf("write pid file %s failed: %v", s.PidFile, err)
 		}
 
 		select {
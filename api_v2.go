@@ -0,0 +1,431 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/gorilla/mux"
+)
+
+// API v2 answers with the typed values below and real http status codes,
+// every error is sent as ErrorResponse. The routes are also used to generate
+// the OpenAPI document at /api/v2/openapi.json.
+
+const apiV2Prefix = "/api/v2"
+
+// APIError is sent as {"error": {"code": "not_found", "message": "..."}}
+type APIError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"` // bad_request, not_found, conflict, invalid_config, internal_error
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+type ErrorResponse struct {
+	Error *APIError `json:"error"`
+}
+
+func apiError(status int, code string, format string, args ...interface{}) *APIError {
+	return &APIError{Status: status, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func errBadRequest(format string, args ...interface{}) *APIError {
+	return apiError(http.StatusBadRequest, "bad_request", format, args...)
+}
+
+func errNotFound(format string, args ...interface{}) *APIError {
+	return apiError(http.StatusNotFound, "not_found", format, args...)
+}
+
+type ServerStatus struct {
+	Version  string `json:"version"`
+	Programs int    `json:"programs"`
+}
+
+type SignalRequest struct {
+	Signal string `json:"signal"` // eg: HUP, SIGUSR1 or 10
+}
+
+type ScaleRequest struct {
+	NumProcs int `json:"numprocs"`
+}
+
+type SilenceRequest struct {
+	Program  string `json:"program"`  // program name or glob pattern, * for all programs
+	Duration string `json:"duration"` // eg: 2h30m
+	Comment  string `json:"comment,omitempty"`
+}
+
+type Message struct {
+	Message string `json:"message"`
+}
+
+type apiParam struct {
+	Name        string
+	Type        string // string, integer or boolean
+	Description string
+}
+
+type apiRoute struct {
+	Method   string
+	Path     string // relative to /api/v2
+	Summary  string
+	Query    []apiParam
+	Request  interface{} // json body
+	Response interface{} // nil means 204 no content
+	Status   int         // status of success, default 200
+	Handler  func(r *http.Request) (interface{}, error)
+}
+
+func (s *Supervisor) apiV2Routes() []apiRoute {
+	limit := apiParam{"limit", "integer", "max number of items"}
+	selector := apiParam{"selector", "string", "label selector, eg: team=payments,tier!=db. name in path can also be all or a glob pattern"}
+	group := apiParam{"group", "string", "only programs in the group"}
+	return []apiRoute{
+		{Method: "GET", Path: "/status", Summary: "Server status", Response: ServerStatus{}, Handler: s.v2Status},
+		{Method: "POST", Path: "/reload", Summary: "Reload config file",
+			Query:    []apiParam{{"dry_run", "boolean", "only report what would change"}},
+			Response: ReloadPlan{}, Handler: s.v2Reload},
+		{Method: "POST", Path: "/shutdown", Summary: "Stop all programs and shutdown server", Response: Message{}, Status: http.StatusAccepted, Handler: s.v2Shutdown},
+
+		{Method: "GET", Path: "/programs", Summary: "List programs",
+			Query:    []apiParam{group, {"selector", "string", "label selector, eg: team=payments,tier!=db"}},
+			Response: []Process{}, Handler: s.v2ListPrograms},
+		{Method: "POST", Path: "/programs", Summary: "Add program", Request: Program{}, Response: Process{}, Status: http.StatusCreated, Handler: s.v2AddProgram},
+		{Method: "GET", Path: "/programs/{name}", Summary: "Get program", Response: Process{}, Handler: s.v2GetProgram},
+		{Method: "PUT", Path: "/programs/{name}", Summary: "Update program, restart it if running", Request: Program{}, Response: Program{}, Handler: s.v2UpdateProgram},
+		{Method: "DELETE", Path: "/programs/{name}", Summary: "Stop and delete program", Handler: s.v2DeleteProgram},
+		{Method: "POST", Path: "/programs/{name}/start", Summary: "Start programs", Query: []apiParam{group, selector}, Response: []OperateResult{}, Status: http.StatusAccepted, Handler: s.v2Operate(OpStart)},
+		{Method: "POST", Path: "/programs/{name}/stop", Summary: "Stop programs", Query: []apiParam{group, selector}, Response: []OperateResult{}, Status: http.StatusAccepted, Handler: s.v2Operate(OpStop)},
+		{Method: "POST", Path: "/programs/{name}/restart", Summary: "Restart programs, start the ones not running",
+			Query: []apiParam{group, selector,
+				{"rolling", "boolean", "restart batch at a time, wait every instance ready before the next batch"},
+				{"batch", "integer", "instances restarted at a time of rolling restart, default 1"},
+			},
+			Response: []OperateResult{}, Status: http.StatusAccepted, Handler: s.v2Operate(OpRestart)},
+		{Method: "POST", Path: "/programs/{name}/signal", Summary: "Send signal to running programs", Query: []apiParam{group, selector}, Request: SignalRequest{}, Response: []OperateResult{}, Status: http.StatusAccepted, Handler: s.v2Operate(OpSignal)},
+		{Method: "PUT", Path: "/programs/{name}/scale", Summary: "Change numprocs, instances are added or removed", Request: ScaleRequest{}, Response: Program{}, Handler: s.v2ScaleProgram},
+		{Method: "GET", Path: "/programs/{name}/runs", Summary: "Run history, newest first", Query: []apiParam{limit}, Response: []Run{}, Handler: s.v2ProgramRuns},
+		{Method: "GET", Path: "/programs/{name}/deploys", Summary: "Webhook deploys, newest first", Query: []apiParam{limit}, Response: []Deploy{}, Handler: s.v2ProgramDeploys},
+
+		{Method: "GET", Path: "/events", Summary: "Event history, oldest first",
+			Query: []apiParam{
+				{"program", "string", "program name"},
+				{"type", "string", "event type: state, added, updated, deleted, action"},
+				{"since", "string", "RFC3339 time or duration before now, eg: 2h"},
+				{"until", "string", "RFC3339 time or duration before now"},
+				limit,
+			},
+			Response: []Event{}, Handler: s.v2Events},
+
+		{Method: "GET", Path: "/silences", Summary: "List silences", Response: []Silence{}, Handler: s.v2ListSilences},
+		{Method: "POST", Path: "/silences", Summary: "Suppress notifications of programs", Request: SilenceRequest{}, Response: Silence{}, Status: http.StatusCreated, Handler: s.v2AddSilence},
+		{Method: "DELETE", Path: "/silences/{id}", Summary: "Remove silence", Handler: s.v2DeleteSilence},
+
+		{Method: "GET", Path: "/openapi.json", Summary: "This document", Response: map[string]interface{}{}, Handler: s.v2OpenAPI},
+	}
+}
+
+func (s *Supervisor) handleAPIv2(r *mux.Router) {
+	sub := r.PathPrefix(apiV2Prefix).Subrouter()
+	for _, route := range s.apiV2Routes() {
+		sub.HandleFunc(route.Path, serveAPIv2(route)).Methods(route.Method)
+	}
+	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, apiV2Prefix+"/") {
+			writeAPIv2(w, http.StatusNotFound, ErrorResponse{errNotFound("%s %s not found", r.Method, r.URL.Path)})
+			return
+		}
+		http.NotFound(w, r)
+	})
+}
+
+func serveAPIv2(route apiRoute) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		value, err := route.Handler(r)
+		if err != nil {
+			apiErr, ok := err.(*APIError)
+			if !ok {
+				apiErr = apiError(http.StatusInternalServerError, "internal_error", "%v", err)
+			}
+			if apiErr.Status >= 500 {
+				log.Warnf("%s %s: %v", r.Method, r.URL.Path, apiErr.Message)
+			}
+			writeAPIv2(w, apiErr.Status, ErrorResponse{apiErr})
+			return
+		}
+		if route.Response == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		status := route.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		writeAPIv2(w, status, value)
+	}
+}
+
+func writeAPIv2(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func decodeAPIv2(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return errBadRequest("invalid json body: %v", err)
+	}
+	return nil
+}
+
+func queryInt(r *http.Request, name string, defaultValue int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errBadRequest("%s should be integer", name)
+	}
+	return n, nil
+}
+
+func (s *Supervisor) v2Proc(r *http.Request) (*Process, error) {
+	return s.lookupProcess(mux.Vars(r)["name"])
+}
+
+func (s *Supervisor) v2Status(r *http.Request) (interface{}, error) {
+	return ServerStatus{Version: Version, Programs: len(s.programs())}, nil
+}
+
+func (s *Supervisor) v2Reload(r *http.Request) (interface{}, error) {
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	if !dryRun {
+		s.recordAction(r, "reload", "")
+	}
+	plan, err := s.loadDB(dryRun)
+	if err != nil {
+		return nil, apiError(http.StatusUnprocessableEntity, "invalid_config", "%v", err)
+	}
+	return plan, nil
+}
+
+func (s *Supervisor) v2Shutdown(r *http.Request) (interface{}, error) {
+	s.recordAction(r, "shutdown", "")
+	s.Close()
+	s.CleanFile()
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		os.Exit(0)
+	}()
+	return Message{"gosuv server has been shutdown"}, nil
+}
+
+func (s *Supervisor) v2ListPrograms(r *http.Request) (interface{}, error) {
+	query := r.URL.Query()
+	return s.filterProcs(query.Get("group"), query.Get("selector"))
+}
+
+func (s *Supervisor) v2GetProgram(r *http.Request) (interface{}, error) {
+	return s.v2Proc(r)
+}
+
+func (s *Supervisor) v2AddProgram(r *http.Request) (interface{}, error) {
+	var pg Program
+	if err := decodeAPIv2(r, &pg); err != nil {
+		return nil, err
+	}
+	if err := pg.Check(); err != nil {
+		return nil, errBadRequest("%v", err)
+	}
+	name := pg.ProgramName()
+	if _, ok := s.program(name); ok {
+		return nil, apiError(http.StatusConflict, "conflict", "program %s already exists", strconv.Quote(name))
+	}
+	if err := s.checkDependencies(pg); err != nil {
+		return nil, errBadRequest("%v", err)
+	}
+	if err := s.addOrUpdateProgram(pg); err != nil {
+		return nil, errBadRequest("%v", err)
+	}
+	if err := s.saveDB(); err != nil {
+		return nil, err
+	}
+	return s.programProcs(name)[0], nil
+}
+
+func (s *Supervisor) v2UpdateProgram(r *http.Request) (interface{}, error) {
+	name := mux.Vars(r)["name"]
+	origPg, ok := s.program(name)
+	if !ok {
+		return nil, errNotFound("program %s not exists", strconv.Quote(name))
+	}
+	var pg Program
+	if err := decodeAPIv2(r, &pg); err != nil {
+		return nil, err
+	}
+	// not in json, keep the config of the file
+	pg.Notifications, pg.WebHook = origPg.Notifications, origPg.WebHook
+	if pg.Name == "" {
+		pg.Name = name
+	}
+	if pg.ProgramName() != name {
+		return nil, errBadRequest("program name %s can not be changed", strconv.Quote(name))
+	}
+	if err := pg.Check(); err != nil {
+		return nil, errBadRequest("%v", err)
+	}
+	if err := s.checkDependencies(pg); err != nil {
+		return nil, errBadRequest("%v", err)
+	}
+	if err := s.addOrUpdateProgram(pg); err != nil {
+		return nil, errBadRequest("%v", err)
+	}
+	if err := s.saveDB(); err != nil {
+		return nil, err
+	}
+	return pg, nil
+}
+
+func (s *Supervisor) v2DeleteProgram(r *http.Request) (interface{}, error) {
+	name := mux.Vars(r)["name"]
+	if _, ok := s.program(name); !ok {
+		return nil, errNotFound("program %s not exists", strconv.Quote(name))
+	}
+	s.removeProgram(name)
+	return nil, s.saveDB()
+}
+
+func (s *Supervisor) v2ScaleProgram(r *http.Request) (interface{}, error) {
+	var req ScaleRequest
+	if err := decodeAPIv2(r, &req); err != nil {
+		return nil, err
+	}
+	name := mux.Vars(r)["name"]
+	s.recordAction(r, fmt.Sprintf("scale %d", req.NumProcs), name)
+	return s.scaleProgram(name, req.NumProcs)
+}
+
+func (s *Supervisor) v2Operate(op string) func(r *http.Request) (interface{}, error) {
+	return func(r *http.Request) (interface{}, error) {
+		var sig syscall.Signal
+		if op == OpSignal {
+			var req SignalRequest
+			if err := decodeAPIv2(r, &req); err != nil {
+				return nil, err
+			}
+			var err error
+			if sig, err = parseSignal(req.Signal); err != nil {
+				return nil, errBadRequest("%v", err)
+			}
+		}
+		query := r.URL.Query()
+		procs, err := s.selectProcs(mux.Vars(r)["name"], query.Get("group"), query.Get("selector"))
+		if err != nil {
+			return nil, err
+		}
+		if rolling, _ := strconv.ParseBool(query.Get("rolling")); op == OpRestart && rolling {
+			batch, err := queryInt(r, "batch", 1)
+			if err != nil {
+				return nil, err
+			}
+			return s.operateRolling(r, procs, batch), nil
+		}
+		return s.operate(r, op, procs, sig), nil
+	}
+}
+
+func (s *Supervisor) v2ProgramRuns(r *http.Request) (interface{}, error) {
+	proc, err := s.v2Proc(r)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := queryInt(r, "limit", 20)
+	if err != nil {
+		return nil, err
+	}
+	return proc.Runs(limit)
+}
+
+func (s *Supervisor) v2ProgramDeploys(r *http.Request) (interface{}, error) {
+	proc, err := s.v2Proc(r)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := queryInt(r, "limit", 20)
+	if err != nil {
+		return nil, err
+	}
+	return s.Deploys(proc, limit)
+}
+
+func (s *Supervisor) v2Events(r *http.Request) (interface{}, error) {
+	query := r.URL.Query()
+	q := EventQuery{
+		Program: query.Get("program"),
+		Type:    query.Get("type"),
+	}
+	var err error
+	if q.Since, err = parseTimeArg(query.Get("since")); err != nil {
+		return nil, errBadRequest("since: %v", err)
+	}
+	if q.Until, err = parseTimeArg(query.Get("until")); err != nil {
+		return nil, errBadRequest("until: %v", err)
+	}
+	if q.Limit, err = queryInt(r, "limit", 100); err != nil {
+		return nil, err
+	}
+	return s.eventStore.Query(q)
+}
+
+func (s *Supervisor) v2ListSilences(r *http.Request) (interface{}, error) {
+	return s.silences.List(), nil
+}
+
+func (s *Supervisor) v2AddSilence(r *http.Request) (interface{}, error) {
+	var req SilenceRequest
+	if err := decodeAPIv2(r, &req); err != nil {
+		return nil, err
+	}
+	duration, err := time.ParseDuration(req.Duration)
+	if err != nil {
+		return nil, errBadRequest("invalid duration %s", strconv.Quote(req.Duration))
+	}
+	if req.Program == "" {
+		return nil, errBadRequest("program required, use * to silence all programs")
+	}
+	silence, err := s.silences.Add(req.Program, duration, req.Comment)
+	if err != nil {
+		return nil, errBadRequest("%v", err)
+	}
+	s.recordAction(r, "silence "+duration.String(), req.Program)
+	return silence, nil
+}
+
+func (s *Supervisor) v2DeleteSilence(r *http.Request) (interface{}, error) {
+	id := mux.Vars(r)["id"]
+	err := s.silences.Remove(id)
+	if err == errSilenceNotExist {
+		return nil, errNotFound("silence %s not exists", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.recordAction(r, "unsilence "+id, "")
+	return nil, nil
+}
+
+func (s *Supervisor) v2OpenAPI(r *http.Request) (interface{}, error) {
+	return openAPIDocument(s.apiV2Routes()), nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAPIv2(t *testing.T) {
+	Convey("API v2 should answer with status codes and error envelope", t, func() {
+		dir, err := ioutil.TempDir("", "gosuv")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		s := newTestSupervisor(dir, Program{Name: "web", Command: "sleep 1"})
+		s.silences, err = NewSilenceStore(filepath.Join(dir, DefaultSilenceFile))
+		So(err, ShouldBeNil)
+		s.eventStore, err = NewEventStore(filepath.Join(dir, eventsFileName), LogRotate{})
+		So(err, ShouldBeNil)
+		defer s.eventStore.Close()
+
+		r := mux.NewRouter()
+		s.handleAPIv2(r)
+		ts := httptest.NewServer(r)
+		defer ts.Close()
+
+		call := func(method, path, body string, v interface{}) int {
+			req, _ := http.NewRequest(method, ts.URL+apiV2Prefix+path, strings.NewReader(body))
+			resp, err := http.DefaultClient.Do(req)
+			So(err, ShouldBeNil)
+			defer resp.Body.Close()
+			if v != nil {
+				So(resp.Header.Get("Content-Type"), ShouldStartWith, "application/json")
+				So(json.NewDecoder(resp.Body).Decode(v), ShouldBeNil)
+			}
+			return resp.StatusCode
+		}
+
+		var procs []map[string]interface{}
+		So(call("GET", "/programs", "", &procs), ShouldEqual, http.StatusOK)
+		So(len(procs), ShouldEqual, 1)
+		So(procs[0]["status"], ShouldEqual, string(Stopped))
+		So(procs[0]["program"].(map[string]interface{})["name"], ShouldEqual, "web")
+		So(procs[0], ShouldContainKey, "outputStats")
+		So(call("GET", "/programs?selector=tier", "", &procs), ShouldEqual, http.StatusOK)
+		So(len(procs), ShouldEqual, 0)
+
+		var errResp ErrorResponse
+		So(call("GET", "/programs/nope", "", &errResp), ShouldEqual, http.StatusNotFound)
+		So(errResp.Error.Code, ShouldEqual, "not_found")
+		So(errResp.Error.Message, ShouldContainSubstring, "nope")
+
+		So(call("GET", "/nothing", "", &errResp), ShouldEqual, http.StatusNotFound)
+		So(call("POST", "/programs", "{bad json", &errResp), ShouldEqual, http.StatusBadRequest)
+		So(errResp.Error.Code, ShouldEqual, "bad_request")
+		So(call("POST", "/programs", `{"name":"web","command":"sleep 2"}`, &errResp), ShouldEqual, http.StatusConflict)
+		So(call("PUT", "/programs/web", `{"name":"api","command":"sleep 2"}`, &errResp), ShouldEqual, http.StatusBadRequest)
+		So(call("PUT", "/programs/web", `{"name":"web","command":"sleep 1","labels":{"tier":"web"}}`, nil), ShouldEqual, http.StatusOK)
+		pgs, err := readProgramFile(s.programPath())
+		So(err, ShouldBeNil)
+		So(pgs[0].Labels, ShouldResemble, map[string]string{"tier": "web"})
+		So(call("GET", "/programs?selector==web", "", &errResp), ShouldEqual, http.StatusBadRequest)
+		So(call("GET", "/programs/web/runs?limit=ten", "", &errResp), ShouldEqual, http.StatusBadRequest)
+		So(call("GET", "/events?since=yesterday", "", &errResp), ShouldEqual, http.StatusBadRequest)
+
+		var silence Silence
+		So(call("POST", "/silences", `{"program":"web","duration":"forever"}`, &errResp), ShouldEqual, http.StatusBadRequest)
+		So(call("POST", "/silences", `{"duration":"1h"}`, &errResp), ShouldEqual, http.StatusBadRequest)
+		So(call("POST", "/silences", `{"program":"web","duration":"1h"}`, &silence), ShouldEqual, http.StatusCreated)
+		So(silence.Program, ShouldEqual, "web")
+		So(call("DELETE", "/silences/"+silence.ID, "", nil), ShouldEqual, http.StatusNoContent)
+		So(call("DELETE", "/silences/"+silence.ID, "", &errResp), ShouldEqual, http.StatusNotFound)
+
+		var events []Event
+		So(call("GET", "/events?type=action", "", &events), ShouldEqual, http.StatusOK)
+		So(len(events), ShouldEqual, 2)
+		So(events[0].Action, ShouldEqual, "silence 1h0m0s")
+	})
+
+	Convey("OpenAPI document should be generated from the routes", t, func() {
+		var doc struct {
+			Paths      map[string]map[string]json.RawMessage `json:"paths"`
+			Components struct {
+				Schemas map[string]struct {
+					Properties map[string]map[string]interface{} `json:"properties"`
+				} `json:"schemas"`
+			} `json:"components"`
+		}
+		data, err := json.Marshal(openAPIDocument((&Supervisor{}).apiV2Routes()))
+		So(err, ShouldBeNil)
+		So(json.Unmarshal(data, &doc), ShouldBeNil)
+
+		So(doc.Paths["/programs/{name}"], ShouldContainKey, "get")
+		So(doc.Paths["/programs/{name}"], ShouldContainKey, "delete")
+		So(string(doc.Paths["/programs/{name}/runs"]["get"]), ShouldContainSubstring, `"name":"limit"`)
+
+		process := doc.Components.Schemas["Process"].Properties
+		So(process["program"]["$ref"], ShouldEqual, "#/components/schemas/Program")
+		So(process["exitTime"]["format"], ShouldEqual, "date-time")
+		So(process, ShouldNotContainKey, "FSM")
+		So(doc.Components.Schemas["Program"].Properties, ShouldNotContainKey, "WebHook")
+		So(doc.Components.Schemas["ErrorResponse"].Properties["error"]["$ref"], ShouldEqual, "#/components/schemas/APIError")
+	})
+}
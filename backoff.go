@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	BackoffFixed       = "fixed"
+	BackoffLinear      = "linear"
+	BackoffExponential = "exponential"
+
+	defaultRetryDelay    = 2   // seconds
+	defaultMaxRetryDelay = 300 // seconds, caps the growing delays if max_delay is not set
+	defaultHealthyUptime = 60  // seconds
+)
+
+// Backoff decides how long to wait before restarting a quitted program.
+// Delay and MaxDelay are in seconds, Jitter is a fraction of the delay,
+// eg: 0.2 means random +/- 20%.
+type Backoff struct {
+	Strategy string  `yaml:"strategy,omitempty" json:"strategy"`
+	Delay    int     `yaml:"delay,omitempty" json:"delay"`
+	MaxDelay int     `yaml:"max_delay,omitempty" json:"maxDelay"`
+	Jitter   float64 `yaml:"jitter,omitempty" json:"jitter"`
+}
+
+// Duration returns the wait time before the n-th retry, n starts from 1
+func (b Backoff) Duration(n int) time.Duration {
+	if n < 1 {
+		n = 1
+	}
+	delay := float64(b.Delay)
+	if delay <= 0 {
+		delay = defaultRetryDelay
+	}
+	maxDelay := float64(b.MaxDelay)
+	if maxDelay <= 0 {
+		maxDelay = math.Max(delay, defaultMaxRetryDelay)
+	}
+	switch b.Strategy {
+	case BackoffLinear:
+		delay *= float64(n)
+	case BackoffExponential:
+		delay *= math.Pow(2, float64(n-1)) // +Inf for a large n, clamped below
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	if b.Jitter > 0 {
+		delay += delay * b.Jitter * (2*rand.Float64() - 1)
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	if delay*float64(time.Second) >= math.MaxInt64 {
+		// max_delay of centuries, out of the range of time.Duration
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(delay * float64(time.Second))
+}
+
+func (b Backoff) Check() error {
+	switch b.Strategy {
+	case "", BackoffFixed, BackoffLinear, BackoffExponential:
+		return nil
+	}
+	return fmt.Errorf("unknown backoff strategy: %s", b.Strategy)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBackoff(t *testing.T) {
+	Convey("Backoff delay should follow the strategy", t, func() {
+		So(Backoff{}.Duration(3), ShouldEqual, 2*time.Second)
+		So(Backoff{Strategy: BackoffFixed, Delay: 5}.Duration(3), ShouldEqual, 5*time.Second)
+		So(Backoff{Strategy: BackoffLinear, Delay: 1}.Duration(3), ShouldEqual, 3*time.Second)
+		So(Backoff{Strategy: BackoffExponential, Delay: 1}.Duration(4), ShouldEqual, 8*time.Second)
+		So(Backoff{Strategy: BackoffExponential, Delay: 1, MaxDelay: 5}.Duration(4), ShouldEqual, 5*time.Second)
+		So(Backoff{Strategy: BackoffExponential, Delay: 1}.Duration(2000), ShouldEqual, defaultMaxRetryDelay*time.Second)
+		So(Backoff{Strategy: BackoffLinear, Delay: 600}.Duration(3), ShouldEqual, 600*time.Second)
+		So(Backoff{Strategy: BackoffExponential, Delay: 1, MaxDelay: 1 << 40}.Duration(100), ShouldBeGreaterThan, 0)
+
+		d := Backoff{Delay: 10, Jitter: 0.5}.Duration(1)
+		So(d, ShouldBeBetweenOrEqual, 5*time.Second, 15*time.Second)
+
+		So(Backoff{Strategy: "random"}.Check(), ShouldNotBeNil)
+	})
+}
@@ -1,193 +1,203 @@
 package main
 
 import (
-	"errors"
-	"io"
 	"sync"
-	"time"
-
-	log "github.com/cihub/seelog"
-	"github.com/glycerine/rbuf"
+	"sync/atomic"
 )
 
-// The new broadcast
-type StreamWriter struct {
-	wc     io.WriteCloser
-	stream string
+// RingStats counts the bytes gone through a Ring
+type RingStats struct {
+	Written int64 `json:"written"`
+	Dropped int64 `json:"dropped"` // bytes skipped by slow readers
 }
 
-type WriteBroadcaster struct {
-	sync.Mutex
-	buf     *rbuf.FixedSizeRingBuf
-	writers map[StreamWriter]bool
-	closed  bool
+type ringMsg struct {
+	seq    uint64
+	offset int64 // bytes written before the message
+	size   int
+	value  interface{}
 }
 
-func NewWriteBroadcaster(size int) *WriteBroadcaster {
+// Ring keeps the latest messages up to size bytes. Every reader reads at its
+// own cursor, so the writer never waits and a slow reader only skips the
+// messages it missed without stalling the others.
+type Ring struct {
+	mu     sync.Mutex
+	size   int
+	msgs   []ringMsg
+	bytes  int    // bytes kept in msgs
+	seq    uint64 // seq of the last message
+	notify chan struct{}
+	closed bool
+	Stats  *RingStats
+}
+
+func NewRing(size int) *Ring {
 	if size <= 0 {
 		size = 4 * 1024
 	}
-	bc := &WriteBroadcaster{
-		writers: make(map[StreamWriter]bool),
-		buf:     rbuf.NewFixedSizeRingBuf(size),
-		closed:  false,
+	return &Ring{
+		size:   size,
+		notify: make(chan struct{}),
+		Stats:  &RingStats{},
 	}
-	return bc
 }
 
-func (wb *WriteBroadcaster) Closed() bool {
-	return wb.closed
-}
-
-// this is main func
-func (wb *WriteBroadcaster) NewChanString(name string) chan string {
-	wb.Lock()
-	defer wb.Unlock()
-
-	wr := NewChanStrWriter()
-	if wb.closed {
-		wr.Close()
-		return nil
+// Put adds a message of size bytes and returns its seq,
+// the message is dropped if the ring is closed.
+func (r *Ring) Put(value interface{}, size int) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return r.seq
 	}
-	sw := StreamWriter{wc: wr, stream: name}
-	wb.writers[sw] = true
-	wr.Write(wb.buf.Bytes())
-	return wr.C
-}
-
-func (wb *WriteBroadcaster) Bytes() []byte {
-	return wb.buf.Bytes()
-}
-
-func (w *WriteBroadcaster) Write(p []byte) (n int, err error) {
-	w.Lock()
-	defer w.Unlock()
-
-	// write with advance
-	w.buf.WriteAndMaybeOverwriteOldestData(p)
-
-	for sw := range w.writers {
-		// set write timeout
-		err = GoTimeout(func() error {
-			if _, err := sw.wc.Write(p); err != nil { //|| n != len(p) {
-				return errors.New("broadcast to " + sw.stream + " error")
-			}
-			return nil
-		}, time.Second*1)
-		if err != nil {
-			// On error, evict the writer
-			log.Warnf("broadcase write error: %s, %s", sw.stream, err)
-			sw.wc.Close()
-			delete(w.writers, sw)
-		}
+	r.seq++
+	r.msgs = append(r.msgs, ringMsg{
+		seq:    r.seq,
+		offset: atomic.LoadInt64(&r.Stats.Written),
+		size:   size,
+		value:  value,
+	})
+	r.bytes += size
+	atomic.AddInt64(&r.Stats.Written, int64(size))
+	// always keep the last message
+	for len(r.msgs) > 1 && r.bytes > r.size {
+		r.bytes -= r.msgs[0].size
+		r.msgs = r.msgs[1:]
 	}
-	return len(p), nil
+	close(r.notify)
+	r.notify = make(chan struct{})
+	return r.seq
 }
 
-func (w *WriteBroadcaster) CloseWriter(name string) {
-	for sw := range w.writers {
-		if sw.stream == name {
-			sw.wc.Close()
-		}
-	}
+// Seq returns the seq of the last message
+func (r *Ring) Seq() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.seq
 }
 
-func (w *WriteBroadcaster) CloseWriters() error {
-	w.Lock()
-	defer w.Unlock()
-	for sw := range w.writers {
-		sw.wc.Close()
+func (r *Ring) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.closed {
+		r.closed = true
+		close(r.notify)
 	}
-	w.writers = make(map[StreamWriter]bool)
-	w.closed = true
 	return nil
 }
 
-// // nop writer
-// type NopWriter struct{}
-
-// func (*NopWriter) Write(buf []byte) (int, error) {
-// 	return len(buf), nil
-// }
-
-// type nopWriteCloser struct {
-// 	io.Writer
-// }
-
-// func (w *nopWriteCloser) Close() error { return nil }
-
-// func NopWriteCloser(w io.Writer) io.WriteCloser {
-// 	return &nopWriteCloser{w}
-// }
-
-// chan string writer
-type chanStrWriter struct {
-	C      chan string
-	closed bool
-	mu     sync.Mutex
-}
-
-func (c *chanStrWriter) Write(data []byte) (n int, err error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.closed {
-		return 0, errors.New("chan writer closed")
+// NewCursor returns a cursor reading the messages after seq afterSeq,
+// 0 means all the kept messages
+func (r *Ring) NewCursor(afterSeq uint64) *Cursor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := &Cursor{
+		ring: r,
+		next: afterSeq + 1,
+		done: make(chan struct{}),
 	}
-	c.C <- string(data) // write timeout
-	return len(data), nil
-}
-
-func (c *chanStrWriter) Close() error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if !c.closed {
-		c.closed = true
-		close(c.C)
+	if c.next > r.seq+1 {
+		// seq of an old server, read the new messages
+		c.next = r.seq + 1
 	}
-	return nil
-}
-
-func NewChanStrWriter() *chanStrWriter {
-	return &chanStrWriter{
-		C: make(chan string, 10),
+	if len(r.msgs) > 0 && c.next < r.msgs[0].seq {
+		// missed while disconnected, the client can tell from the seq
+		c.next = r.msgs[0].seq
+	}
+	if len(r.msgs) > 0 && c.next <= r.seq {
+		c.offset = r.msgs[c.next-r.msgs[0].seq].offset
+	} else {
+		c.offset = atomic.LoadInt64(&r.Stats.Written)
+	}
+	return c
+}
+
+// Cursor is the read position of a reader
+type Cursor struct {
+	ring   *Ring
+	next   uint64 // seq of the next message
+	offset int64  // bytes read or skipped
+	done   chan struct{}
+	once   sync.Once
+}
+
+// Next blocks until the next message is available. skipped is the bytes
+// overwritten before the reader got them, value is nil in that case.
+// ok is false when the ring or the cursor is closed.
+func (c *Cursor) Next() (value interface{}, seq uint64, skipped int64, ok bool) {
+	r := c.ring
+	for {
+		r.mu.Lock()
+		if len(r.msgs) > 0 && c.next < r.msgs[0].seq {
+			first := r.msgs[0]
+			skipped = first.offset - c.offset
+			seq = first.seq - 1
+			c.next, c.offset = first.seq, first.offset
+			r.mu.Unlock()
+			atomic.AddInt64(&r.Stats.Dropped, skipped)
+			return nil, seq, skipped, true
+		}
+		if c.next <= r.seq {
+			m := r.msgs[c.next-r.msgs[0].seq]
+			c.next++
+			c.offset = m.offset + int64(m.size)
+			r.mu.Unlock()
+			return m.value, m.seq, 0, true
+		}
+		notify, closed := r.notify, r.closed
+		r.mu.Unlock()
+		if closed {
+			return nil, 0, 0, false
+		}
+		select {
+		case <-notify:
+		case <-c.done:
+			return nil, 0, 0, false
+		}
 	}
 }
 
-// quick loss writer
-type QuickLossBroadcastWriter struct {
-	*WriteBroadcaster
-	bufC   chan string
-	closed bool
+// Close stops the cursor, a blocked Next returns at once
+func (c *Cursor) Close() error {
+	c.once.Do(func() { close(c.done) })
+	return nil
 }
 
-func (w *QuickLossBroadcastWriter) Write(buf []byte) (int, error) {
-	select {
-	case w.bufC <- string(buf):
-	default:
-	}
-	return len(buf), nil
+// Chan sends the messages to a channel until the cursor is closed,
+// skipped bytes are ignored
+func (c *Cursor) Chan() <-chan interface{} {
+	ch := make(chan interface{})
+	go func() {
+		defer close(ch)
+		for {
+			value, _, skipped, ok := c.Next()
+			if !ok {
+				return
+			}
+			if skipped > 0 {
+				continue
+			}
+			select {
+			case ch <- value:
+			case <-c.done:
+				return
+			}
+		}
+	}()
+	return ch
 }
 
-func (w *QuickLossBroadcastWriter) Close() error {
-	if !w.closed {
-		w.closed = true
-		close(w.bufC)
-		w.WriteBroadcaster.CloseWriters()
-	}
-	return nil
+// WriteBroadcaster keeps every Write as a message in a Ring
+type WriteBroadcaster struct {
+	*Ring
 }
 
-func (w *QuickLossBroadcastWriter) drain() {
-	for data := range w.bufC {
-		w.WriteBroadcaster.Write([]byte(data))
-	}
+func NewWriteBroadcaster(size int) *WriteBroadcaster {
+	return &WriteBroadcaster{Ring: NewRing(size)}
 }
 
-func NewQuickLossBroadcastWriter(size int) *QuickLossBroadcastWriter {
-	qlw := &QuickLossBroadcastWriter{
-		WriteBroadcaster: NewWriteBroadcaster(size),
-		bufC:             make(chan string, 20),
-	}
-	go qlw.drain()
-	return qlw
+func (wb *WriteBroadcaster) Write(p []byte) (int, error) {
+	wb.Put(string(p), len(p))
+	return len(p), nil
 }
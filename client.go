@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -15,6 +16,7 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	log "github.com/cihub/seelog"
 	_ "github.com/shurcooL/vfsgen"
@@ -100,6 +102,8 @@ func NewClient() *Client {
 	actions["getProgram"] = ActionMap{Uri: "/api/programs/", Method: "GET"}
 	actions["delProgram"] = ActionMap{Uri: "/api/programs/", Method: "DELETE"}
 	actions["programs"] = ActionMap{Uri: "/api/programs/", Method: "POST"}
+	actions["silences"] = ActionMap{Uri: "/api/silences", Method: "GET"}
+	actions["events"] = ActionMap{Uri: "/api/events", Method: "GET"}
 
 	cl.Action = actions
 
@@ -154,7 +158,10 @@ func actionProgramStatus(c *cli.Context) error {
 		Status  string  `json:"status"`
 	}, 0)
 
-	request, _ := http.NewRequest(cl.Action["getProgramStatus"].Method, cl.Addr+cl.Action["getProgramStatus"].Uri, nil)
+	query := url.Values{}
+	query.Set("group", c.String("group"))
+	query.Set("selector", c.String("selector"))
+	request, _ := http.NewRequest(cl.Action["getProgramStatus"].Method, cl.Addr+cl.Action["getProgramStatus"].Uri+"?"+query.Encode(), nil)
 	request.SetBasicAuth(cl.User, cl.Password)
 
 	var resp *http.Response
@@ -174,80 +181,318 @@ func actionProgramStatus(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	if resp.StatusCode == http.StatusBadRequest {
+		return errors.New(strings.TrimSpace(string(body)))
+	}
 
 	err = json.Unmarshal(body, &programs)
 	if err != nil {
 		return errors.New("json loads error: " + string(body))
 	}
 
+	// programs without group first, then every group in order
+	groups := []string{}
+	members := make(map[string][]int)
 	format := "%-23s\t%-8s\n"
 	fmt.Printf(format, "PROGRAM NAME", "STATUS")
-	for _, p := range programs {
-		fmt.Printf(format, p.Program.Name, p.Status)
+	for i, p := range programs {
+		if p.Program.Group == "" {
+			fmt.Printf(format, p.Program.Name, p.Status)
+			continue
+		}
+		if _, ok := members[p.Program.Group]; !ok {
+			groups = append(groups, p.Program.Group)
+		}
+		members[p.Program.Group] = append(members[p.Program.Group], i)
+	}
+	for _, group := range groups {
+		fmt.Println(group + ":")
+		for _, i := range members[group] {
+			fmt.Printf(format, "  "+programs[i].Program.Name, programs[i].Status)
+		}
 	}
 	return nil
 }
 
-func actionStart(c *cli.Context) (err error) {
+func actionStart(c *cli.Context) error {
+	return operatePrograms(c, OpStart, "Started", nil)
+}
 
-	name := c.Args().First()
+func actionStop(c *cli.Context) error {
+	return operatePrograms(c, OpStop, "Stopped", nil)
+}
 
-	success, err := programOperate("start", name)
+func actionRestartProgram(c *cli.Context) error {
+	if !c.Bool("rolling") {
+		return operatePrograms(c, OpRestart, "Restarted", nil)
+	}
+	data := url.Values{}
+	data.Set("rolling", "true")
+	data.Set("batch", strconv.Itoa(c.Int("batch")))
+	return operatePrograms(c, OpRestart, "Restarted", data)
+}
+
+// gosuv signal <name|all|pattern> <signal>, eg: gosuv signal nginx HUP
+func actionSignal(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return errors.New("usage: gosuv signal <name|all|pattern> <signal>")
+	}
+	data := url.Values{}
+	data.Set("signal", c.Args().Get(1))
+	return operatePrograms(c, OpSignal, "Signaled", data)
+}
+
+// gosuv scale <name> <n>, instances are added or removed, the others keep running
+func actionScale(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return errors.New("usage: gosuv scale <name> <numprocs>")
+	}
+	data := url.Values{}
+	data.Set("numprocs", c.Args().Get(1))
+	ret, err := requestForm("PUT", cl.Addr+cl.Action["programs"].Uri+url.PathEscape(c.Args().First())+"/scale", data)
 	if err != nil {
-		return
+		return err
 	}
-	if success {
-		fmt.Println(name, "Started")
-	} else {
-		fmt.Println(name, "Start failed")
+	if ret.Status != 0 {
+		return fmt.Errorf("%v", ret.Value)
 	}
+	fmt.Println(ret.Value)
 	return nil
 }
 
-func actionStop(c *cli.Context) (err error) {
+// operatePrograms sends op to the programs of the first argument(name, all or glob pattern),
+// --group and --selector, prints the result of every program.
+func operatePrograms(c *cli.Context, op, done string, data url.Values) error {
 	name := c.Args().First()
-	success, err := programOperate("stop", name)
+	if name == "" && (c.String("group") != "" || c.String("selector") != "") {
+		name = "all"
+	}
+	if name == "" {
+		return errors.New("program name, all or pattern required")
+	}
+	if data == nil {
+		data = url.Values{}
+	}
+	data.Set("group", c.String("group"))
+	data.Set("selector", c.String("selector"))
+	ret, err := postForm(cl.Addr+cl.Action["programs"].Uri+url.PathEscape(name)+"/"+op, data)
 	if err != nil {
-		return
+		return err
+	}
+	if msg, ok := ret.Value.(string); ok {
+		return errors.New(msg)
 	}
-	if !success {
-		fmt.Println(name, "Stop failed")
+	var results []OperateResult
+	raw, _ := json.Marshal(ret.Value)
+	if err := json.Unmarshal(raw, &results); err != nil {
+		return err
+	}
+	failed := 0
+	for _, r := range results {
+		if r.OK {
+			fmt.Println(r.Name, done)
+		} else {
+			failed++
+			fmt.Printf("%s %s failed: %s\n", r.Name, strings.Title(op), r.Error)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d programs failed", failed, len(results))
 	}
 	return nil
 }
 
-// cmd: <start|stop>
-func programOperate(cmd, name string) (success bool, err error) {
-
-	request, _ := http.NewRequest(cl.Action["programs"].Method, cl.Addr+cl.Action["programs"].Uri+name+"/"+cmd, nil)
-	request.SetBasicAuth(Cfg.Server.Auth.User, Cfg.Server.Auth.Password)
+// getJSON sends GET request to the server and decode the response into v
+func getJSON(uri string, v interface{}) error {
+	request, _ := http.NewRequest("GET", cl.Addr+uri, nil)
+	request.SetBasicAuth(cl.User, cl.Password)
 
 	var resp *http.Response
+	var err error
 	if cl.UnixClient {
 		resp, err = cl.UnixHTTP.Do(request)
 	} else {
 		resp, err = http.DefaultClient.Do(request)
 	}
 	if err != nil {
-		return false, err
+		return err
 	}
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return false, err
+		return err
+	}
+	if err = json.Unmarshal(body, v); err != nil {
+		return errors.New("json loads error: " + string(body))
 	}
+	return nil
+}
 
-	var v = struct {
-		Status int `json:"status"`
-	}{}
+// program run history
+func actionRuns(c *cli.Context) error {
+	name := c.Args().First()
+	if name == "" {
+		return errors.New("program name required")
+	}
+	var ret struct {
+		Status int             `json:"status"`
+		Value  json.RawMessage `json:"value"`
+	}
+	uri := fmt.Sprintf("%s%s/runs?limit=%d", cl.Action["getProgram"].Uri, url.PathEscape(name), c.Int("n"))
+	if err := getJSON(uri, &ret); err != nil {
+		return err
+	}
+	if ret.Status != 0 {
+		return fmt.Errorf("%s", ret.Value)
+	}
+	var runs []Run
+	if err := json.Unmarshal(ret.Value, &runs); err != nil {
+		return err
+	}
+	format := "%-20s\t%-10s\t%s\n"
+	fmt.Printf(format, "START TIME", "DURATION", "EXIT")
+	for _, r := range runs {
+		exit := strconv.Itoa(r.ExitCode)
+		if r.Running {
+			exit = "running"
+		} else if r.ExitSignal != "" {
+			exit = r.ExitSignal
+		}
+		duration := time.Duration(r.Duration * float64(time.Second)).Round(time.Millisecond)
+		fmt.Printf(format, r.StartTime.Format("2006-01-02 15:04:05"), duration, exit)
+	}
+	return nil
+}
 
-	err = json.Unmarshal(body, &v)
+// gosuv events [program]: show the event history, eg: gosuv events --since 2h web
+func actionEvents(c *cli.Context) error {
+	query := url.Values{}
+	query.Set("program", c.Args().First())
+	query.Set("type", c.String("type"))
+	query.Set("since", c.String("since"))
+	query.Set("until", c.String("until"))
+	query.Set("limit", strconv.Itoa(c.Int("n")))
+	var ret struct {
+		Status int             `json:"status"`
+		Value  json.RawMessage `json:"value"`
+	}
+	if err := getJSON(cl.Action["events"].Uri+"?"+query.Encode(), &ret); err != nil {
+		return err
+	}
+	if ret.Status != 0 {
+		return fmt.Errorf("%s", ret.Value)
+	}
+	var events []Event
+	if err := json.Unmarshal(ret.Value, &events); err != nil {
+		return err
+	}
+	format := "%-20s\t%-16s\t%-8s\t%s\n"
+	fmt.Printf(format, "TIME", "PROGRAM", "TYPE", "DETAIL")
+	for _, e := range events {
+		var detail string
+		switch e.Type {
+		case EventState:
+			detail = string(e.From + " -> " + e.To)
+			if e.Reason != "" {
+				detail += " (" + e.Reason + ")"
+			}
+		case EventAction:
+			detail = e.Action + " by " + e.Source
+		case EventError:
+			detail = e.Reason
+		}
+		fmt.Printf(format, e.Time.Format("2006-01-02 15:04:05"), e.Program, e.Type, detail)
+	}
+	return nil
+}
+
+// tail program log, works with both unix and http server
+func actionTail(c *cli.Context) error {
+	name := c.Args().First()
+	if name == "" {
+		return errors.New("program name required")
+	}
+	query := url.Values{}
+	query.Set("lines", strconv.Itoa(c.Int("n")))
+	if c.Bool("stderr") {
+		query.Set("stream", "stderr")
+	}
+	if c.Bool("follow") {
+		query.Set("follow", "1")
+	}
+	uri := cl.Addr + cl.Action["getProgram"].Uri + url.PathEscape(name) + "/log?" + query.Encode()
+	request, _ := http.NewRequest("GET", uri, nil)
+	request.SetBasicAuth(cl.User, cl.Password)
+
+	var resp *http.Response
+	var err error
+	if cl.UnixClient {
+		resp, err = cl.UnixHTTP.Do(request)
+	} else {
+		resp, err = http.DefaultClient.Do(request)
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return errors.New(strings.TrimSpace(string(body)))
+	}
+	_, err = io.Copy(os.Stdout, resp.Body)
+	return err
+}
+
+// gosuv silence: list silences
+// gosuv silence <program> <duration>: suppress notifications of program, eg: gosuv silence web 2h
+func actionSilence(c *cli.Context) error {
+	if c.NArg() == 0 {
+		var ret struct {
+			Status int       `json:"status"`
+			Value  []Silence `json:"value"`
+		}
+		if err := getJSON(cl.Action["silences"].Uri, &ret); err != nil {
+			return err
+		}
+		format := "%-16s\t%-20s\t%-20s\t%s\n"
+		fmt.Printf(format, "ID", "PROGRAM", "UNTIL", "COMMENT")
+		for _, s := range ret.Value {
+			fmt.Printf(format, s.ID, s.Program, s.Until.Format("2006-01-02 15:04:05"), s.Comment)
+		}
+		return nil
+	}
+	if c.NArg() != 2 {
+		return errors.New("usage: gosuv silence <program> <duration>")
+	}
+	data := url.Values{}
+	data.Set("program", c.Args().Get(0))
+	data.Set("duration", c.Args().Get(1))
+	data.Set("comment", c.String("comment"))
+	ret, err := postForm(cl.Addr+cl.Action["silences"].Uri, data)
 	if err != nil {
-		return false, errors.New("json loads error: " + string(body))
+		return err
+	}
+	if ret.Status != 0 {
+		return fmt.Errorf("%v", ret.Value)
 	}
+	value, _ := ret.Value.(map[string]interface{})
+	fmt.Printf("silence %v created, until %v\n", value["id"], value["until"])
+	return nil
+}
 
-	success = v.Status == 0
-	return success, nil
+func actionUnsilence(c *cli.Context) error {
+	id := c.Args().First()
+	if id == "" {
+		return errors.New("silence id required")
+	}
+	ret, err := requestForm("DELETE", cl.Addr+cl.Action["silences"].Uri+"/"+url.PathEscape(id), nil)
+	if err != nil {
+		return err
+	}
+	if ret.Status != 0 {
+		return fmt.Errorf("%v", ret.Value)
+	}
+	return nil
 }
 
 /*
@@ -281,14 +526,50 @@ func actionRestart(c *cli.Context) error {
 }
 
 func actionReload(c *cli.Context) error {
-	ret, err := postForm(cl.Addr+cl.Action["reload"].Uri, nil)
+	uri := cl.Addr + cl.Action["reload"].Uri
+	if c.Bool("dry-run") {
+		uri += "?dry_run=1"
+	}
+	ret, err := postForm(uri, nil)
 	if err != nil {
 		return err
 	}
-	fmt.Println(ret.Value)
+	if ret.Status != 0 {
+		return fmt.Errorf("reload failed: %v", ret.Value)
+	}
+	// Value is a ReloadPlan, decode it again into the typed struct
+	var plan ReloadPlan
+	data, _ := json.Marshal(ret.Value)
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return errors.New("json loads error: " + string(data))
+	}
+	printReloadPlan(plan)
 	return nil
 }
 
+func printReloadPlan(plan ReloadPlan) {
+	format := "%-10s\t%-23s\t%s\n"
+	fmt.Printf(format, "ACTION", "PROGRAM NAME", "CHANGED")
+	for _, name := range plan.Added {
+		fmt.Printf(format, "added", name, "")
+	}
+	for _, name := range plan.Removed {
+		fmt.Printf(format, "removed", name, "")
+	}
+	for _, ch := range plan.Restarted {
+		fmt.Printf(format, "restarted", ch.Name, strings.Join(ch.Fields, ","))
+	}
+	for _, ch := range plan.Updated {
+		fmt.Printf(format, "updated", ch.Name, strings.Join(ch.Fields, ","))
+	}
+	for _, name := range plan.Unchanged {
+		fmt.Printf(format, "unchanged", name, "")
+	}
+	if plan.DryRun {
+		fmt.Println("dry run, nothing changed")
+	}
+}
+
 /*
 	命令行
 */
@@ -301,7 +582,9 @@ func actionVersion(c *cli.Context) error {
 
 //测试配置文件
 func actionConfigTest(c *cli.Context) error {
-	if _, _, err := newSupervisorHandler(); err != nil {
+	// only check the programs, the server is not created
+	s := &Supervisor{ConfigDir: CfgDir}
+	if err := s.checkConfig(); err != nil {
 		return err
 	}
 	fmt.Println("test is successful")
@@ -352,11 +635,16 @@ func actionServerStatus() error {
 }
 
 func postForm(urlPath string, data url.Values) (r *JSONResponse, err error) {
+	return requestForm("POST", urlPath, data)
+}
+
+func requestForm(method, urlPath string, data url.Values) (r *JSONResponse, err error) {
 
-	request, err := http.NewRequest("POST", urlPath, strings.NewReader(data.Encode()))
+	request, err := http.NewRequest(method, urlPath, strings.NewReader(data.Encode()))
 	if err != nil {
 		return r, err
 	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	request.SetBasicAuth(cl.User, cl.Password)
 
 	var resp *http.Response
@@ -376,7 +664,7 @@ func postForm(urlPath string, data url.Values) (r *JSONResponse, err error) {
 	}
 	err = json.Unmarshal(body, &r)
 	if err != nil {
-		return r, fmt.Errorf("POST %v %v", strconv.Quote(urlPath), string(body))
+		return r, fmt.Errorf("%s %v %v", method, strconv.Quote(urlPath), string(body))
 	}
 	return r, nil
 }
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/go-yaml/yaml"
 )
@@ -23,6 +27,13 @@ type GosuvServer struct {
 	Log     GosuvLog `yaml:"log"`
 	MinFds	int `yaml:"minfds"`
 	MinProcs int `yaml:"minprocs"`
+	Notify  GosuvNotify `yaml:"notify"`
+	Events  LogRotate   `yaml:"events"` // retention of the event history
+}
+
+type GosuvNotify struct {
+	DedupeWindow int `yaml:"dedupe_window"` // seconds, identical alerts within it are sent once
+	RateLimit    int `yaml:"rate_limit"`    // max notifications per channel per minute
 }
 
 type GosuvClient struct {
@@ -73,6 +84,15 @@ func readConf(filename string) (c Configuration, err error) {
 	c.Server.Log.Level="info"
 	c.Server.Log.FileMax=10000
 
+	c.Server.Notify.DedupeWindow=defaultDedupeWindow
+	c.Server.Notify.RateLimit=defaultRateLimit
+
+	c.Server.Events.MaxSize="10MB"
+	c.Server.Events.Daily=true
+	c.Server.Events.Compress=true
+	c.Server.Events.MaxBackups=30
+	c.Server.Events.MaxAge=30
+
 	data, err := ioutil.ReadFile(filename)
 	if err != nil {
 		data = []byte("")
@@ -92,10 +112,46 @@ func readConf(filename string) (c Configuration, err error) {
 	return
 }
 
+// ProgramFiles returns every file programs are read from. The first one is
+// always programs.yml in baseDir, which is where new programs are saved.
+// Include holds space separated globs or directories relative to baseDir,
+// a directory means all the *.yml and *.yaml files in it.
+func (c Configuration) ProgramFiles(baseDir string) ([]string, error) {
+	files := []string{filepath.Join(baseDir, DefaultProgramFile)}
+	visited := map[string]bool{files[0]: true}
+	for _, pattern := range strings.Fields(c.Include) {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(baseDir, pattern)
+		}
+		var matches []string
+		if IsDir(pattern) {
+			for _, ext := range []string{"*.yml", "*.yaml"} {
+				m, _ := filepath.Glob(filepath.Join(pattern, ext))
+				matches = append(matches, m...)
+			}
+		} else {
+			m, err := filepath.Glob(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("include %s: %v", strconv.Quote(pattern), err)
+			}
+			matches = m
+		}
+		sort.Strings(matches)
+		for _, file := range matches {
+			file = filepath.Clean(file)
+			if visited[file] || IsDir(file) {
+				continue
+			}
+			visited[file] = true
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
 
 /*
-include: ./conf/programs.yml
-# include主要是Programs的配置 看是一个文件还是多个文件.
+include: ./conf.d/*.yml ./conf/programs.yml
+# include主要是Programs的配置 可以是多个文件,目录或者通配符,用空格分隔. programs.yml总是会被读取.
 server:
   httpserver:
     enabled: true
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMain(m *testing.M) {
+	// keep program logs out of the source tree
+	logPath, _ := ioutil.TempDir("", "gosuv-logs")
+	Cfg.Server.Log.LogPath = logPath
+	code := m.Run()
+	os.RemoveAll(logPath)
+	os.Exit(code)
+}
+
+func TestProgramFiles(t *testing.T) {
+	Convey("Include should expand globs and directories", t, func() {
+		dir, err := ioutil.TempDir("", "gosuv")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		os.MkdirAll(filepath.Join(dir, "conf.d"), 0755)
+		ioutil.WriteFile(filepath.Join(dir, "conf.d", "b.yml"), []byte("- name: b\n  command: echo b\n"), 0644)
+		ioutil.WriteFile(filepath.Join(dir, "conf.d", "a.yaml"), []byte("- name: a\n  command: echo a\n"), 0644)
+		ioutil.WriteFile(filepath.Join(dir, "conf.d", "README"), []byte("ignored"), 0644)
+		ioutil.WriteFile(filepath.Join(dir, "extra.yml"), []byte("- name: extra\n  command: echo extra\n"), 0644)
+
+		c := Configuration{Include: "conf.d extra.yml conf.d/*.yml"}
+		files, err := c.ProgramFiles(dir)
+		So(err, ShouldBeNil)
+		So(files, ShouldResemble, []string{
+			filepath.Join(dir, DefaultProgramFile),
+			filepath.Join(dir, "conf.d", "a.yaml"),
+			filepath.Join(dir, "conf.d", "b.yml"),
+			filepath.Join(dir, "extra.yml"),
+		})
+
+		s := &Supervisor{ConfigDir: dir}
+		pgs, sources, err := s.readConfigFromDB(files)
+		So(err, ShouldBeNil)
+		So(len(pgs), ShouldEqual, 3)
+		So(sources["a"], ShouldEqual, filepath.Join(dir, "conf.d", "a.yaml"))
+
+		Convey("Duplicated name should report the file", func() {
+			ioutil.WriteFile(filepath.Join(dir, DefaultProgramFile), []byte("- name: extra\n  command: echo dup\n"), 0644)
+			_, _, err := s.readConfigFromDB(files)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, filepath.Join(dir, "extra.yml"))
+		})
+
+		Convey("Save should write programs back to their own file", func() {
+			s.names = []string{"a", "b", "extra"}
+			s.files = files
+			s.pgMap = make(map[string]Program)
+			for _, pg := range pgs {
+				s.pgMap[pg.Name] = pg
+			}
+			s.pgFiles = sources
+			pg := s.pgMap["a"]
+			pg.Command = "echo changed"
+			s.pgMap["a"] = pg
+			So(s.saveDB(), ShouldBeNil)
+
+			saved, err := readProgramFile(filepath.Join(dir, "conf.d", "a.yaml"))
+			So(err, ShouldBeNil)
+			So(len(saved), ShouldEqual, 1)
+			So(saved[0].Command, ShouldEqual, "echo changed")
+			_, err = os.Stat(filepath.Join(dir, DefaultProgramFile))
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+	})
+}
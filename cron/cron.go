@@ -0,0 +1,183 @@
+// Package cron parses standard 5 fields crontab expressions
+//
+//	minute hour day-of-month month day-of-week
+//
+// Every field supports *, a-b, a,b, */n and a-b/n. Month and weekday
+// accept names like jan or mon. @yearly, @monthly, @weekly, @daily and
+// @hourly are also supported.
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type field struct {
+	min, max int
+	names    map[string]int
+}
+
+var fields = []field{
+	{0, 59, nil},
+	{0, 23, nil},
+	{1, 31, nil},
+	{1, 12, map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}},
+	{0, 7, map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}},
+}
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// when both day-of-month and day-of-week are restricted, match either of them
+	domStar, dowStar bool
+}
+
+// Parse a crontab expression
+func Parse(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if d, ok := descriptors[spec]; ok {
+		spec = d
+	}
+	parts := strings.Fields(spec)
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("cron: expect 5 fields, got %d: %s", len(parts), strconv.Quote(spec))
+	}
+	bits := make([]uint64, 5)
+	for i, part := range parts {
+		b, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron: %s: %v", strconv.Quote(spec), err)
+		}
+		bits[i] = b
+	}
+	// 7 is also sunday
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return &Schedule{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: strings.HasPrefix(parts[2], "*"),
+		dowStar: strings.HasPrefix(parts[4], "*"),
+	}, nil
+}
+
+func parseField(expr string, f field) (bits uint64, err error) {
+	for _, item := range strings.Split(expr, ",") {
+		step := 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			step, err = strconv.Atoi(item[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %s", strconv.Quote(item))
+			}
+			item = item[:i]
+		}
+		start, end := f.min, f.max
+		switch {
+		case item == "*":
+		case strings.Contains(item, "-"):
+			rng := strings.SplitN(item, "-", 2)
+			if start, err = f.value(rng[0]); err != nil {
+				return
+			}
+			if end, err = f.value(rng[1]); err != nil {
+				return
+			}
+		default:
+			if start, err = f.value(item); err != nil {
+				return
+			}
+			end = start
+			if step > 1 {
+				end = f.max
+			}
+		}
+		if start > end {
+			return 0, fmt.Errorf("invalid range %s", strconv.Quote(item))
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (f field) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %s", strconv.Quote(s))
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d]", v, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Match reports whether the minute of t is in the schedule
+func (s *Schedule) Match(t time.Time) bool {
+	if s.minute&(1<<uint(t.Minute())) == 0 ||
+		s.hour&(1<<uint(t.Hour())) == 0 ||
+		s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	return s.dayMatch(t)
+}
+
+var errNoNext = errors.New("cron: no next time in 5 years")
+
+// Next returns the first matched minute after t
+func (s *Schedule) Next(t time.Time) (time.Time, error) {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.Match(t) {
+			return t, nil
+		}
+		if !s.dayMatch(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		t = t.Add(time.Minute)
+	}
+	return time.Time{}, errNoNext
+}
+
+func (s *Schedule) dayMatch(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,51 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	for _, spec := range []string{"* * * * *", "*/5 * * * *", "0 9-18/3 * jan-jun mon-fri", "@daily", "0 0 1,15 * 7"} {
+		if _, err := Parse(spec); err != nil {
+			t.Errorf("parse %s: %v", spec, err)
+		}
+	}
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("parse %s should fail", spec)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	base := time.Date(2017, 12, 4, 16, 15, 30, 0, time.UTC) // monday
+	cases := []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2017, 12, 4, 16, 16, 0, 0, time.UTC)},
+		{"*/5 * * * *", time.Date(2017, 12, 4, 16, 20, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2017, 12, 5, 9, 0, 0, 0, time.UTC)},
+		{"30 8 * * sat", time.Date(2017, 12, 9, 8, 30, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * fri", time.Date(2017, 12, 8, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		s, err := Parse(c.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		next, err := s.Next(base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !next.Equal(c.next) {
+			t.Errorf("%s: expect next %v, got %v", c.spec, c.next, next)
+		}
+		if !s.Match(next) {
+			t.Errorf("%s: next %v should match", c.spec, next)
+		}
+	}
+}
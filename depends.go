@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+// startOrder sorts programs by depends_on, dependencies come first.
+// Programs without order constraint are sorted by priority (lower first),
+// then by the order in program files.
+func startOrder(pgs []Program) ([]string, error) {
+	index := make(map[string]int, len(pgs))
+	for i, pg := range pgs {
+		index[pg.ProgramName()] = i
+	}
+	indegree := make(map[string]int, len(pgs))
+	dependents := make(map[string][]string)
+	for _, pg := range pgs {
+		name := pg.ProgramName()
+		for _, dep := range pg.DependsOn {
+			if _, ok := index[dep]; !ok {
+				return nil, fmt.Errorf("program %s depends on unknown program %s", name, dep)
+			}
+			indegree[name]++
+			dependents[dep] = append(dependents[dep], name)
+		}
+	}
+	less := func(a, b string) bool {
+		pa, pb := pgs[index[a]], pgs[index[b]]
+		if pa.Priority != pb.Priority {
+			return pa.Priority < pb.Priority
+		}
+		return index[a] < index[b]
+	}
+	ready := make([]string, 0)
+	for _, pg := range pgs {
+		if indegree[pg.ProgramName()] == 0 {
+			ready = append(ready, pg.ProgramName())
+		}
+	}
+	order := make([]string, 0, len(pgs))
+	for len(ready) > 0 {
+		sort.Slice(ready, func(i, j int) bool { return less(ready[i], ready[j]) })
+		name := ready[0]
+		ready = ready[1:]
+		order = append(order, name)
+		for _, next := range dependents[name] {
+			indegree[next]--
+			if indegree[next] == 0 {
+				ready = append(ready, next)
+			}
+		}
+	}
+	if len(order) != len(pgs) {
+		return nil, findCycle(pgs)
+	}
+	return order, nil
+}
+
+// findCycle returns an error like "dependency cycle: a -> b -> a"
+func findCycle(pgs []Program) error {
+	deps := make(map[string][]string, len(pgs))
+	for _, pg := range pgs {
+		deps[pg.ProgramName()] = pg.DependsOn
+	}
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int)
+	path := make([]string, 0)
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range deps[name] {
+			switch state[dep] {
+			case visiting:
+				for i, n := range path {
+					if n == dep {
+						return append(append([]string{}, path[i:]...), dep)
+					}
+				}
+			case unvisited:
+				if cycle := visit(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = done
+		return nil
+	}
+	for _, pg := range pgs {
+		if state[pg.ProgramName()] == unvisited {
+			if cycle := visit(pg.ProgramName()); cycle != nil {
+				return fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+			}
+		}
+	}
+	return errors.New("dependency cycle")
+}
+
+// orderedProcs returns processes in start order, falls back to config order on error
+func (s *Supervisor) orderedProcs() []*Process {
+	order, err := startOrder(s.programs())
+	if err != nil {
+		log.Warnf("sort programs: %v", err)
+		return s.procs()
+	}
+	ps := make([]*Process, 0, len(order))
+	for _, name := range order {
+		ps = append(ps, s.programProcs(name)...)
+	}
+	return ps
+}
+
+// waitDependencies blocks until all dependencies of p (every instance) are ready,
+// returns error if any of them will not come up or is not ready in time.
+func (s *Supervisor) waitDependencies(p *Process) error {
+	for _, name := range p.DependsOn {
+		deps := s.programProcs(name)
+		if len(deps) == 0 {
+			return fmt.Errorf("dependency %s not exists", name)
+		}
+		for _, dep := range deps {
+			timeout := readyTimeout(dep)
+			deadline := time.Now().Add(timeout)
+			for !dep.IsReady() {
+				switch dep.State() {
+				case Stopped, Fatal, Exited:
+					return fmt.Errorf("dependency %s is %s", dep.Name, dep.State())
+				}
+				if time.Now().After(deadline) {
+					return fmt.Errorf("dependency %s is not ready in %v", dep.Name, timeout)
+				}
+				time.Sleep(100 * time.Millisecond)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStartOrder(t *testing.T) {
+	Convey("Programs should start after their dependencies", t, func() {
+		pgs := []Program{
+			{Name: "web", DependsOn: []string{"db", "cache"}},
+			{Name: "worker", DependsOn: []string{"db"}, Priority: 10},
+			{Name: "cache", Priority: 5},
+			{Name: "db"},
+			{Name: "cron", Priority: 1},
+		}
+		order, err := startOrder(pgs)
+		So(err, ShouldBeNil)
+		So(order, ShouldResemble, []string{"db", "cron", "cache", "web", "worker"})
+	})
+
+	Convey("Unknown dependency and cycle should be reported", t, func() {
+		_, err := startOrder([]Program{{Name: "a", DependsOn: []string{"b"}}})
+		So(err, ShouldNotBeNil)
+
+		_, err = startOrder([]Program{
+			{Name: "a", DependsOn: []string{"b"}},
+			{Name: "b", DependsOn: []string{"c"}},
+			{Name: "c", DependsOn: []string{"a"}},
+			{Name: "d"},
+		})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "dependency cycle: a -> b -> c -> a")
+	})
+}
+
+func TestAutoStartPrograms(t *testing.T) {
+	Convey("A dependency which never comes up should only block its dependents", t, func() {
+		s := newTestSupervisor("",
+			// stays in retry wait
+			Program{Name: "db", Command: "exit 1", StartAuto: true, StartRetries: 3, Backoff: Backoff{Delay: 30}},
+			Program{Name: "web", Command: "sleep 30", StartAuto: true, DependsOn: []string{"db"}},
+			Program{Name: "cache", Command: "sleep 30", StartAuto: true},
+		)
+		done := make(chan struct{})
+		go func() {
+			s.AutoStartPrograms()
+			close(done)
+		}()
+		time.Sleep(500 * time.Millisecond)
+		So(s.procMap["db"].State(), ShouldEqual, RetryWait)
+		So(s.procMap["cache"].State(), ShouldEqual, Running)
+		So(s.procMap["web"].State(), ShouldEqual, Stopped)
+
+		s.procMap["db"].Operate(StopEvent)
+		finished := false
+		select {
+		case <-done:
+			finished = true
+		case <-time.After(2 * time.Second):
+		}
+		So(finished, ShouldBeTrue)
+		So(s.procMap["web"].State(), ShouldEqual, Stopped)
+		s.procMap["cache"].Operate(StopEvent)
+	})
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"syscall"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/codeskyblue/kexec"
+)
+
+const (
+	deploysFileName = "deploys.log"
+	deployLogDir    = "deploys"
+	maxDeployLogs   = 50
+)
+
+const (
+	DeployQueued    = "queued"
+	DeployRunning   = "running"
+	DeploySucceeded = "succeeded"
+	DeployFailed    = "failed"
+	DeployTimeout   = "timed out"
+)
+
+var deployIDPattern = regexp.MustCompile(`^[0-9a-f]+$`)
+
+// Deploy is one run of the webhook command, finished deploys are appended to
+// <logpath>/<name>/deploys.log as json lines, the output is saved to
+// <logpath>/<name>/deploys/<id>.log
+type Deploy struct {
+	ID         string     `json:"id"`
+	Category   string     `json:"category"`
+	Ref        string     `json:"ref,omitempty"`
+	Status     string     `json:"status"`
+	QueueTime  time.Time  `json:"queueTime"`
+	StartTime  *time.Time `json:"startTime,omitempty"`
+	Duration   float64    `json:"duration"` // seconds
+	Error      string     `json:"error,omitempty"`
+	Coalesced  int        `json:"coalesced,omitempty"` // triggers merged into this deploy while queued
+	RolledBack bool       `json:"rolledBack,omitempty"`
+	Restarted  bool       `json:"restarted"`
+}
+
+// deployQueue runs the deploys of a program one by one, the triggers during a
+// deploy are coalesced into the only queued deploy
+type deployQueue struct {
+	current *Deploy
+	queued  *Deploy
+}
+
+// triggerDeploy queues a deploy of program, returns the deploy which will run it
+func (s *Supervisor) triggerDeploy(name, category, ref string) Deploy {
+	s.deployMu.Lock()
+	defer s.deployMu.Unlock()
+	if s.deploys == nil {
+		s.deploys = make(map[string]*deployQueue)
+	}
+	q, ok := s.deploys[name]
+	if !ok {
+		q = &deployQueue{}
+		s.deploys[name] = q
+	}
+	if q.queued != nil {
+		q.queued.Coalesced++
+		q.queued.Category, q.queued.Ref = category, ref
+		return *q.queued
+	}
+	now := time.Now()
+	d := &Deploy{
+		ID:        fmt.Sprintf("%x", now.UnixNano()),
+		Category:  category,
+		Ref:       ref,
+		Status:    DeployQueued,
+		QueueTime: now,
+	}
+	if q.current != nil {
+		q.queued = d
+		return *d
+	}
+	q.current = d
+	go s.runDeploys(name)
+	return *d
+}
+
+func (s *Supervisor) runDeploys(name string) {
+	for {
+		s.deployMu.Lock()
+		d := s.deploys[name].current
+		now := time.Now()
+		d.Status = DeployRunning
+		d.StartTime = &now
+		s.deployMu.Unlock()
+
+		s.runDeploy(name, d)
+
+		s.deployMu.Lock()
+		q := s.deploys[name]
+		q.current, q.queued = q.queued, nil
+		if q.current == nil {
+			delete(s.deploys, name)
+			s.deployMu.Unlock()
+			return
+		}
+		s.deployMu.Unlock()
+	}
+}
+
+func (s *Supervisor) runDeploy(name string, d *Deploy) {
+	proc, ok := s.process(name)
+	if !ok {
+		s.finishDeploy(nil, d, DeployFailed, "program removed", false, false)
+		return
+	}
+	hook := proc.Program.WebHook
+	dir := filepath.Join(proc.logDir(), deployLogDir)
+	os.MkdirAll(dir, 0755)
+	f, err := os.Create(filepath.Join(dir, d.ID+".log"))
+	if err != nil {
+		s.finishDeploy(proc, d, DeployFailed, err.Error(), false, false)
+		return
+	}
+	defer f.Close()
+
+	fromState, isRunning := proc.State(), proc.IsRunning()
+	s.stopAndWait(name)
+	fmt.Fprintf(f, "--- deploy %s by %s webhook %s\n", d.ID, d.Category, d.Ref)
+	status, errMsg := DeploySucceeded, ""
+	if err := runHookCommand(proc, hook.Command, hook.timeout(), f); err != nil {
+		status, errMsg = DeployFailed, err.Error()
+		if err == ErrCommandTimeout {
+			status = DeployTimeout
+		}
+	}
+	fmt.Fprintf(f, "--- %s\n", status)
+
+	restart, rolledBack := isRunning, false
+	if status != DeploySucceeded {
+		log.Warnf("[%s] deploy %s %s: %s", name, d.ID, status, errMsg)
+		switch hook.onFailure() {
+		case HookFailureStop:
+			restart = false
+		case HookFailureRollback:
+			fmt.Fprintf(f, "--- rollback\n")
+			if err := runHookCommand(proc, hook.Rollback, hook.timeout(), f); err != nil {
+				errMsg += ", rollback: " + err.Error()
+				restart = false
+			} else {
+				rolledBack = true
+			}
+		}
+	}
+	if restart {
+		proc.Operate(StartEvent)
+		proc.restarted(fromState)
+	}
+	s.finishDeploy(proc, d, status, errMsg, rolledBack, restart)
+}
+
+func runHookCommand(proc *Process, command string, timeout time.Duration, w io.Writer) error {
+	cmd := kexec.CommandString(command)
+	cmd.Dir = proc.Program.Dir
+	cmd.Stdout = w
+	cmd.Stderr = w
+	// waits for the command, so the log is not closed under it
+	return runTimeout(cmd, timeout, syscall.SIGTERM)
+}
+
+func (s *Supervisor) finishDeploy(proc *Process, d *Deploy, status, errMsg string, rolledBack, restarted bool) {
+	s.deployMu.Lock()
+	d.Status = status
+	d.Error = errMsg
+	d.RolledBack = rolledBack
+	d.Restarted = restarted
+	d.Duration = time.Since(*d.StartTime).Seconds()
+	record := *d
+	s.deployMu.Unlock()
+
+	if proc == nil {
+		return
+	}
+	s.broadcastEvent(Event{
+		Type:    EventAction,
+		Program: proc.Name,
+		Action:  "deploy " + record.ID + " " + status,
+		Source:  "webhook " + record.Category,
+		Time:    time.Now(),
+	})
+	f, err := os.OpenFile(filepath.Join(proc.logDir(), deploysFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		log.Warnf("[%s] save deploy history failed: %v", proc.Name, err)
+		return
+	}
+	defer f.Close()
+	json.NewEncoder(f).Encode(record)
+	removeOldDeployLogs(filepath.Join(proc.logDir(), deployLogDir))
+}
+
+// removeOldDeployLogs keeps the latest maxDeployLogs logs, ids are timestamps so sorted by name
+func removeOldDeployLogs(dir string) {
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	sort.Strings(matches)
+	for i := 0; i < len(matches)-maxDeployLogs; i++ {
+		os.Remove(matches[i])
+	}
+}
+
+// Deploys returns the latest deploys of program, newest first. The running and queued deploys are included.
+func (s *Supervisor) Deploys(proc *Process, limit int) ([]Deploy, error) {
+	deploys := make([]Deploy, 0)
+	f, err := os.Open(filepath.Join(proc.logDir(), deploysFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var d Deploy
+			if json.Unmarshal(scanner.Bytes(), &d) != nil {
+				continue
+			}
+			deploys = append(deploys, d)
+		}
+	}
+	s.deployMu.Lock()
+	if q, ok := s.deploys[proc.Name]; ok {
+		for _, d := range []*Deploy{q.current, q.queued} {
+			if d == nil {
+				continue
+			}
+			if d.Status == DeployRunning {
+				record := *d
+				record.Duration = time.Since(*d.StartTime).Seconds()
+				deploys = append(deploys, record)
+			} else if d.Status == DeployQueued {
+				deploys = append(deploys, *d)
+			}
+		}
+	}
+	s.deployMu.Unlock()
+
+	for i, j := 0, len(deploys)-1; i < j; i, j = i+1, j-1 {
+		deploys[i], deploys[j] = deploys[j], deploys[i]
+	}
+	if limit > 0 && len(deploys) > limit {
+		deploys = deploys[:limit]
+	}
+	return deploys, nil
+}
+
+// DeployLog returns the output of deploy
+func DeployLog(proc *Process, id string) ([]byte, error) {
+	if !deployIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("invalid deploy id %s", id)
+	}
+	return ioutil.ReadFile(filepath.Join(proc.logDir(), deployLogDir, id+".log"))
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDeploy(t *testing.T) {
+	newSupervisor := func(hook WebHook) (*Supervisor, *Process) {
+		s := newTestSupervisor("", Program{Name: "deploy-test", Command: "sleep 10", WebHook: hook})
+		return s, s.procMap["deploy-test"]
+	}
+	waitDeploys := func(s *Supervisor) {
+		for i := 0; i < 50; i++ {
+			s.deployMu.Lock()
+			n := len(s.deploys)
+			s.deployMu.Unlock()
+			if n == 0 {
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	Convey("Triggers during a deploy should be coalesced into one queued deploy", t, func() {
+		s, p := newSupervisor(WebHook{Command: "sleep 0.3; echo built"})
+
+		first := s.triggerDeploy(p.Name, HookGithub, "refs/heads/master")
+		time.Sleep(10 * time.Millisecond)
+		second := s.triggerDeploy(p.Name, HookGithub, "refs/heads/master")
+		third := s.triggerDeploy(p.Name, HookGitea, "refs/heads/release")
+		So(second.ID, ShouldNotEqual, first.ID)
+		So(third.ID, ShouldEqual, second.ID)
+		So(third.Status, ShouldEqual, DeployQueued)
+		So(third.Coalesced, ShouldEqual, 1)
+
+		deploys, err := s.Deploys(p, 0)
+		So(err, ShouldBeNil)
+		So(len(deploys), ShouldEqual, 2)
+		So(deploys[0].Status, ShouldEqual, DeployQueued)
+		So(deploys[1].Status, ShouldEqual, DeployRunning)
+
+		waitDeploys(s)
+		deploys, _ = s.Deploys(p, 2)
+		So(len(deploys), ShouldEqual, 2)
+		So(deploys[0].ID, ShouldEqual, second.ID)
+		So(deploys[0].Ref, ShouldEqual, "refs/heads/release")
+		So(deploys[0].Status, ShouldEqual, DeploySucceeded)
+		So(deploys[0].Restarted, ShouldBeFalse)
+		So(deploys[1].ID, ShouldEqual, first.ID)
+
+		output, err := DeployLog(p, first.ID)
+		So(err, ShouldBeNil)
+		So(string(output), ShouldContainSubstring, "built\n")
+		_, err = DeployLog(p, "../output")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Failed deploy should roll back", t, func() {
+		s, p := newSupervisor(WebHook{Command: "exit 3", Rollback: "echo rollback"})
+		d := s.triggerDeploy(p.Name, HookGeneric, "")
+		waitDeploys(s)
+
+		deploys, _ := s.Deploys(p, 1)
+		So(deploys[0].ID, ShouldEqual, d.ID)
+		So(deploys[0].Status, ShouldEqual, DeployFailed)
+		So(deploys[0].Error, ShouldContainSubstring, "exit status 3")
+		So(deploys[0].RolledBack, ShouldBeTrue)
+		output, _ := DeployLog(p, d.ID)
+		So(string(output), ShouldContainSubstring, "rollback\n")
+	})
+
+	Convey("Deploy should time out", t, func() {
+		s, p := newSupervisor(WebHook{Command: "sleep 5", Timeout: 1, OnFailure: HookFailureStop})
+		So(p.WebHook.Check(), ShouldBeNil)
+		s.triggerDeploy(p.Name, HookGeneric, "")
+		waitDeploys(s)
+
+		deploys, _ := s.Deploys(p, 1)
+		So(deploys[0].Status, ShouldEqual, DeployTimeout)
+		So(deploys[0].RolledBack, ShouldBeFalse)
+	})
+
+	Convey("On failure should be checked", t, func() {
+		So(WebHook{OnFailure: HookFailureRollback}.Check(), ShouldNotBeNil)
+		So(WebHook{OnFailure: "retry"}.Check(), ShouldNotBeNil)
+		So(WebHook{Rollback: "git checkout -"}.onFailure(), ShouldEqual, HookFailureRollback)
+		So(WebHook{}.onFailure(), ShouldEqual, HookFailureRestart)
+	})
+}
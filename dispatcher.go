@@ -0,0 +1,139 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	defaultDedupeWindow = 300 // seconds
+	defaultRateLimit    = 10  // notifications per channel per minute
+)
+
+// Dispatcher sends the notifications of all programs. Identical alerts
+// within the dedupe window are dropped, every channel is rate limited,
+// silenced programs are skipped and a resolved message follows an alert
+// when the program is up again.
+type Dispatcher struct {
+	mu       sync.Mutex
+	window   time.Duration
+	limit    int
+	silences *SilenceStore
+	lastSent map[string]time.Time           // program/event/channel -> last sent time
+	recent   map[string][]time.Time         // channel -> sent times in the last minute
+	alerts   map[string]map[string]Notifier // program -> channels notified of an unresolved alert
+	send     func(ns Notifications, n Notification, notifiers []Notifier)
+}
+
+func NewDispatcher(cfg GosuvNotify, silences *SilenceStore) *Dispatcher {
+	d := &Dispatcher{
+		window:   time.Duration(cfg.DedupeWindow) * time.Second,
+		limit:    cfg.RateLimit,
+		silences: silences,
+		lastSent: make(map[string]time.Time),
+		recent:   make(map[string][]time.Time),
+		alerts:   make(map[string]map[string]Notifier),
+		send: func(ns Notifications, n Notification, notifiers []Notifier) {
+			go ns.SendTo(n, notifiers)
+		},
+	}
+	if cfg.DedupeWindow <= 0 {
+		d.window = defaultDedupeWindow * time.Second
+	}
+	if d.limit <= 0 {
+		d.limit = defaultRateLimit
+	}
+	return d
+}
+
+// isAlert reports whether event needs a resolved message
+func isAlert(event string) bool {
+	return event == NotifyFatal || event == NotifyExited || event == NotifyUnhealthy
+}
+
+// StateChanged is called on every state change of the process
+func (d *Dispatcher) StateChanged(p *Process, oldState, newState FSMState) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+
+	upState := Running
+	if p.HealthCheck.Enabled() {
+		upState = Healthy
+	}
+	if newState == upState && len(d.alerts[p.Name]) > 0 {
+		notifiers := make([]Notifier, 0, len(d.alerts[p.Name]))
+		for _, notifier := range d.alerts[p.Name] {
+			notifiers = append(notifiers, notifier)
+		}
+		delete(d.alerts, p.Name)
+		d.send(p.Notifications, p.notification(NotifyResolved, oldState, newState, now), notifiers)
+	}
+	d.notify(p, notifyEvent(newState), oldState, newState, now)
+}
+
+// Restarted is called when a restart started the program again, from is the state
+// before the restart. Like StateChanged the caller holds p.mu.
+func (d *Dispatcher) Restarted(p *Process, from FSMState) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.notify(p, NotifyRestarted, from, p.State(), time.Now())
+}
+
+// notify sends event to the channels of its trigger, caller holds d.mu
+func (d *Dispatcher) notify(p *Process, event string, oldState, newState FSMState, now time.Time) {
+	if event == "" {
+		return
+	}
+	if d.silences != nil && d.silences.Silenced(p.Name) {
+		log.Infof("[%s] %s notification silenced", p.Name, event)
+		return
+	}
+	notifiers := make([]Notifier, 0)
+	for _, notifier := range p.Notifications.NotifiersOf(event) {
+		if !d.allow(p.Name, event, notifier.Name(), now) {
+			continue
+		}
+		notifiers = append(notifiers, notifier)
+		if isAlert(event) {
+			if d.alerts[p.Name] == nil {
+				d.alerts[p.Name] = make(map[string]Notifier)
+			}
+			d.alerts[p.Name][notifier.Name()] = notifier
+		}
+	}
+	if len(notifiers) > 0 {
+		d.send(p.Notifications, p.notification(event, oldState, newState, now), notifiers)
+	}
+}
+
+// allow checks the dedupe window and the rate limit of channel
+func (d *Dispatcher) allow(name, event, channel string, now time.Time) bool {
+	// drop the expired ones, or it grows with every program ever notified
+	for key, last := range d.lastSent {
+		if now.Sub(last) >= d.window {
+			delete(d.lastSent, key)
+		}
+	}
+	key := name + "/" + event + "/" + channel
+	if _, ok := d.lastSent[key]; ok {
+		log.Debugf("[%s] %s notification to %s deduplicated", name, event, channel)
+		return false
+	}
+	recent := make([]time.Time, 0, d.limit)
+	for _, t := range d.recent[channel] {
+		if now.Sub(t) < time.Minute {
+			recent = append(recent, t)
+		}
+	}
+	d.recent[channel] = recent
+	if len(recent) >= d.limit {
+		log.Warnf("[%s] %s notification to %s dropped, over %d per minute", name, event, channel, d.limit)
+		return false
+	}
+	d.recent[channel] = append(recent, now)
+	d.lastSent[key] = now
+	return true
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type sentNotification struct {
+	Notification
+	channels []string
+}
+
+func newTestDispatcher(cfg GosuvNotify, silences *SilenceStore) (*Dispatcher, *[]sentNotification) {
+	sent := make([]sentNotification, 0)
+	d := NewDispatcher(cfg, silences)
+	d.send = func(ns Notifications, n Notification, notifiers []Notifier) {
+		channels := make([]string, 0)
+		for _, notifier := range notifiers {
+			channels = append(channels, notifier.Name())
+		}
+		sent = append(sent, sentNotification{n, channels})
+	}
+	return d, &sent
+}
+
+func TestDispatcher(t *testing.T) {
+	pg := Program{Name: "web", Command: "echo"}
+	pg.Notifications.Slack.URL = "http://127.0.0.1/slack"
+	pg.Notifications.Triggers = map[string][]string{
+		NotifyFatal:     {"slack"},
+		NotifyRestarted: {"slack"},
+	}
+	p := NewProcess(pg)
+
+	Convey("Identical alerts should be sent once in the window", t, func() {
+		d, sent := newTestDispatcher(GosuvNotify{}, nil)
+		d.StateChanged(p, RetryWait, Fatal)
+		d.StateChanged(p, RetryWait, Fatal)
+		So(len(*sent), ShouldEqual, 1)
+		So((*sent)[0].Event, ShouldEqual, NotifyFatal)
+		So((*sent)[0].channels, ShouldResemble, []string{"slack"})
+
+		Convey("Resolved should follow when the program runs again", func() {
+			d.StateChanged(p, Fatal, Running)
+			So(len(*sent), ShouldEqual, 2)
+			So((*sent)[1].Event, ShouldEqual, NotifyResolved)
+			d.StateChanged(p, Stopped, Running)
+			d.StateChanged(p, RetryWait, Running)
+			So(len(*sent), ShouldEqual, 2)
+		})
+	})
+
+	Convey("Expired dedupe entries should be dropped", t, func() {
+		d, sent := newTestDispatcher(GosuvNotify{}, nil)
+		d.window = 10 * time.Millisecond
+		for _, name := range []string{"web-0", "web-1", "web-2"} {
+			pg := p.Program
+			pg.Name = name
+			d.StateChanged(NewProcess(pg), RetryWait, Fatal)
+		}
+		So(len(*sent), ShouldEqual, 3)
+		So(len(d.lastSent), ShouldEqual, 3)
+		time.Sleep(20 * time.Millisecond)
+		d.StateChanged(p, RetryWait, Fatal)
+		So(len(d.lastSent), ShouldEqual, 1)
+	})
+
+	Convey("Restart should notify restarted", t, func() {
+		restarted := make(chan FSMState, 1)
+		p := NewProcess(Program{Name: "restart", Command: "sleep 10", StopTimeout: 1})
+		p.onRestart = func(from FSMState) { restarted <- from }
+		p.Operate(StartEvent)
+		defer p.Operate(StopEvent)
+
+		p.Operate(RestartEvent)
+		select {
+		case from := <-restarted:
+			So(from, ShouldEqual, Running)
+		case <-time.After(5 * time.Second):
+			So("no restarted notification", ShouldBeEmpty)
+		}
+		So(p.State(), ShouldEqual, Running)
+	})
+
+	Convey("Channel should be rate limited", t, func() {
+		d, sent := newTestDispatcher(GosuvNotify{RateLimit: 2}, nil)
+		d.window = time.Nanosecond
+		for i := 0; i < 5; i++ {
+			d.Restarted(p, RetryWait)
+		}
+		So(len(*sent), ShouldEqual, 2)
+		So((*sent)[0].Event, ShouldEqual, NotifyRestarted)
+	})
+
+	Convey("Silenced program should not notify", t, func() {
+		dir, err := ioutil.TempDir("", "gosuv")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		file := filepath.Join(dir, DefaultSilenceFile)
+
+		ss, err := NewSilenceStore(file)
+		So(err, ShouldBeNil)
+		silence, err := ss.Add("we*", time.Hour, "maintenance")
+		So(err, ShouldBeNil)
+		_, err = ss.Add("web", -time.Hour, "")
+		So(err, ShouldNotBeNil)
+
+		d, sent := newTestDispatcher(GosuvNotify{}, ss)
+		d.StateChanged(p, RetryWait, Fatal)
+		So(len(*sent), ShouldEqual, 0)
+
+		Convey("Silences should survive a restart", func() {
+			loaded, err := NewSilenceStore(file)
+			So(err, ShouldBeNil)
+			So(len(loaded.List()), ShouldEqual, 1)
+			So(loaded.List()[0].Comment, ShouldEqual, "maintenance")
+			So(loaded.Silenced("web"), ShouldBeTrue)
+			So(loaded.Silenced("db"), ShouldBeFalse)
+
+			So(loaded.Remove(silence.ID), ShouldBeNil)
+			loaded, _ = NewSilenceStore(file)
+			So(loaded.Silenced("web"), ShouldBeFalse)
+		})
+	})
+}
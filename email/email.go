@@ -0,0 +1,54 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Params struct {
+	Host     string
+	Port     int // default 25
+	Username string
+	Password string
+	From     string
+	To       []string
+	Title    string
+	Message  string
+}
+
+// Notify sends a plain text mail through the SMTP server,
+// STARTTLS is used when the server supports it.
+func Notify(n Params) error {
+	if len(n.To) == 0 {
+		return fmt.Errorf("no recipient")
+	}
+	port := n.Port
+	if port == 0 {
+		port = 25
+	}
+	var auth smtp.Auth
+	if n.Username != "" {
+		auth = smtp.PlainAuth("", n.Username, n.Password, n.Host)
+	}
+	addr := net.JoinHostPort(n.Host, strconv.Itoa(port))
+	return smtp.SendMail(addr, auth, n.From, n.To, message(n))
+}
+
+func message(n Params) []byte {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "From: %s\r\n", n.From)
+	fmt.Fprintf(buf, "To: %s\r\n", strings.Join(n.To, ", "))
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", n.Title))
+	fmt.Fprintf(buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	buf.WriteString(strings.Replace(n.Message, "\n", "\r\n", -1))
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	log "github.com/cihub/seelog"
+)
+
+// supervisord process states
+var listenerStates = []string{"STOPPED", "STARTING", "RUNNING", "BACKOFF", "STOPPING", "EXITED", "FATAL", "UNKNOWN"}
+
+func knownListenerEvent(name string) bool {
+	if name == "EVENT" || name == "PROCESS_STATE" {
+		return true
+	}
+	return strings.HasPrefix(name, "PROCESS_STATE_") && containsString(listenerStates, strings.TrimPrefix(name, "PROCESS_STATE_"))
+}
+
+// supervisordState converts the state to the supervisord name
+func supervisordState(state FSMState) string {
+	switch state {
+	case Running, Healthy, Unhealthy:
+		return "RUNNING"
+	case Stopping:
+		return "STOPPING"
+	case Stopped:
+		return "STOPPED"
+	case RetryWait:
+		return "BACKOFF"
+	case Exited:
+		return "EXITED"
+	case Fatal:
+		return "FATAL"
+	}
+	return "UNKNOWN"
+}
+
+// ListenerEvent returns the supervisord event name, empty if the change
+// has no supervisord counterpart, eg: running -> healthy
+func (e Event) ListenerEvent() string {
+	if isUp(e.From) && isUp(e.To) {
+		return ""
+	}
+	if e.To == RetryWait {
+		// the program quit and will be restarted
+		return "PROCESS_STATE_EXITED"
+	}
+	return "PROCESS_STATE_" + supervisordState(e.To)
+}
+
+// ListenerPayload returns the payload of the event, see
+// http://supervisord.org/events.html#process-state-event-type
+func (e Event) ListenerPayload() string {
+	payload := fmt.Sprintf("processname:%s groupname:%s from_state:%s", e.Program, e.Program, supervisordState(e.From))
+	switch e.ListenerEvent() {
+	case "PROCESS_STATE_EXITED":
+		expected := 0
+		if e.Expected {
+			expected = 1
+		}
+		payload += fmt.Sprintf(" expected:%d pid:%d", expected, e.Pid)
+	case "PROCESS_STATE_RUNNING", "PROCESS_STATE_STOPPING", "PROCESS_STATE_STOPPED":
+		payload += fmt.Sprintf(" pid:%d", e.Pid)
+	}
+	return payload
+}
+
+// subscribes reports whether the listener wants the event
+func (p *Process) subscribes(event string) bool {
+	if event == "" {
+		return false
+	}
+	for _, name := range p.Events {
+		if name == "EVENT" || name == event || (name == "PROCESS_STATE" && strings.HasPrefix(event, "PROCESS_STATE_")) {
+			return true
+		}
+	}
+	return false
+}
+
+// serveEvents sends the events to the listener with the supervisord protocol:
+// wait for READY, write the header and payload, then read RESULT with OK or FAIL.
+// A rejected event is sent again, the events during the listener is down are
+// kept in the event ring.
+func (p *Process) serveEvents(stdin io.WriteCloser, stdout io.Reader, done chan struct{}) {
+	cursor := p.eventSource.NewCursor(p.eventSeq)
+	go func() {
+		<-done
+		cursor.Close()
+		stdin.Close()
+	}()
+
+	reader := bufio.NewReader(stdout)
+	var pending *Event
+	var pendingSeq uint64
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if strings.TrimSpace(line) != "READY" {
+			log.Warnf("[%s] listener should send READY, got %q", p.Name, line)
+			continue
+		}
+		for pending == nil {
+			value, seq, skipped, ok := cursor.Next()
+			if !ok {
+				return
+			}
+			if skipped > 0 {
+				log.Warnf("[%s] listener too slow, %d bytes of events skipped", p.Name, skipped)
+				continue
+			}
+			if e, ok := value.(Event); ok && e.Type == EventState && p.subscribes(e.ListenerEvent()) {
+				pending, pendingSeq = &e, seq
+			} else {
+				p.eventSeq = seq
+			}
+		}
+
+		p.poolSerial++
+		payload := pending.ListenerPayload()
+		header := fmt.Sprintf("ver:3.0 server:%s serial:%d pool:%s poolserial:%d eventname:%s len:%d\n",
+			AppName, pendingSeq, p.Name, p.poolSerial, pending.ListenerEvent(), len(payload))
+		if _, err := io.WriteString(stdin, header+payload); err != nil {
+			log.Warnf("[%s] send event to listener: %v", p.Name, err)
+			return
+		}
+
+		result, err := readListenerResult(reader)
+		if err != nil {
+			log.Warnf("[%s] read listener result: %v", p.Name, err)
+			return
+		}
+		if result == "OK" {
+			p.eventSeq = pendingSeq
+			pending = nil
+		} else {
+			log.Warnf("[%s] listener rejected event %d: %s, will send again", p.Name, pendingSeq, result)
+		}
+	}
+}
+
+// readListenerResult reads "RESULT <len>\n" and the result body
+func readListenerResult(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(line)
+	if len(fields) != 2 || fields[0] != "RESULT" {
+		return "", fmt.Errorf("should be RESULT <len>, got %q", line)
+	}
+	size, err := strconv.Atoi(fields[1])
+	if err != nil || size < 0 {
+		return "", fmt.Errorf("invalid result length %q", fields[1])
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestListenerPayload(t *testing.T) {
+	Convey("State change should map to supervisord event", t, func() {
+		e := Event{Type: EventState, Program: "web", From: Running, To: RetryWait, Pid: 12, ExitCode: 2}
+		So(e.ListenerEvent(), ShouldEqual, "PROCESS_STATE_EXITED")
+		So(e.ListenerPayload(), ShouldEqual, "processname:web groupname:web from_state:RUNNING expected:0 pid:12")
+
+		e = Event{Type: EventState, Program: "web", From: RetryWait, To: Running, Pid: 13}
+		So(e.ListenerEvent(), ShouldEqual, "PROCESS_STATE_RUNNING")
+		So(e.ListenerPayload(), ShouldEqual, "processname:web groupname:web from_state:BACKOFF pid:13")
+
+		e = Event{Type: EventState, Program: "web", From: Stopped, To: Fatal}
+		So(e.ListenerPayload(), ShouldEqual, "processname:web groupname:web from_state:STOPPED")
+
+		e = Event{Type: EventState, Program: "web", From: Running, To: Healthy}
+		So(e.ListenerEvent(), ShouldEqual, "")
+	})
+
+	Convey("Events should be checked", t, func() {
+		pg := Program{Name: "listener", Command: "cat", Type: ProgramEventListener, Events: []string{"PROCESS_STATE", "PROCESS_STATE_FATAL"}}
+		So(pg.Check(), ShouldBeNil)
+		pg.Events = []string{"TICK_5"}
+		So(pg.Check(), ShouldNotBeNil)
+	})
+}
+
+func TestEventListener(t *testing.T) {
+	Convey("Listener should get the events with header and payload", t, func() {
+		// a minimal listener, writes what it gets to stderr
+		script := `while true; do echo READY; read header; len=${header##*len:}; payload=$(head -c $len); echo "$header|$payload" >&2; printf 'RESULT 2\nOK'; done`
+		eventB := NewWriteBroadcaster(4096)
+		p := NewProcess(Program{
+			Name:       "listener",
+			Command:    script,
+			Type:       ProgramEventListener,
+			Events:     []string{"PROCESS_STATE_EXITED", "PROCESS_STATE_FATAL"},
+			LogDisable: true,
+		})
+		p.eventSource = eventB
+		sub := p.Output.Subscribe(0, "stderr")
+		defer sub.Close()
+		p.Operate(StartEvent)
+		defer p.Operate(StopEvent)
+
+		eventB.Put(programEvent(EventAdded, "web"), 9)
+		eventB.Put(Event{Type: EventState, Program: "web", From: Running, To: Stopping, Pid: 12}, 10)
+		eventB.Put(Event{Type: EventState, Program: "web", From: Running, To: RetryWait, Pid: 12, ExitCode: 2}, 10)
+		eventB.Put(Event{Type: EventState, Program: "web", From: RetryWait, To: Fatal}, 10)
+
+		lines := make(chan string, 2)
+		go func() {
+			for i := 0; i < 2; i++ {
+				line, _ := sub.Next()
+				lines <- line.Text
+			}
+		}()
+		expects := []string{
+			"ver:3.0 server:gosuv serial:3 pool:listener poolserial:1 eventname:PROCESS_STATE_EXITED len:66|" +
+				"processname:web groupname:web from_state:RUNNING expected:0 pid:12",
+			"ver:3.0 server:gosuv serial:4 pool:listener poolserial:2 eventname:PROCESS_STATE_FATAL len:48|" +
+				"processname:web groupname:web from_state:BACKOFF",
+		}
+		for _, expect := range expects {
+			select {
+			case line := <-lines:
+				So(line, ShouldEqual, expect)
+			case <-time.After(5 * time.Second):
+				So("timeout", ShouldEqual, expect)
+			}
+		}
+	})
+}
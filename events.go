@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// event types
+const (
+	EventState   = "state" // state change of a program
+	EventAdded   = "added"
+	EventUpdated = "updated"
+	EventDeleted = "deleted"
+	EventAction  = "action" // admin action, eg: start, stop, reload
+	EventError   = "error"  // failure of gosuv, eg: rolling restart aborted
+)
+
+// Event is broadcast by the supervisor, sent as json on /ws/events and /api/events/stream
+type Event struct {
+	Seq      uint64    `json:"seq"` // filled when read from the event ring
+	Type     string    `json:"type"`
+	Program  string    `json:"program"`
+	From     FSMState  `json:"from,omitempty"`
+	To       FSMState  `json:"to,omitempty"`
+	Pid      int       `json:"pid,omitempty"`
+	ExitCode int       `json:"exitCode"`
+	Expected bool      `json:"expected"` // exit code is in exitcodes and not killed by signal
+	Reason   string    `json:"reason,omitempty"`
+	Action   string    `json:"action,omitempty"`
+	Source   string    `json:"source,omitempty"` // who did the action
+	Time     time.Time `json:"time"`
+}
+
+func (e Event) String() string {
+	switch e.Type {
+	case EventState:
+		return fmt.Sprintf("[%s] state: %s -> %s", e.Program, string(e.From), string(e.To))
+	case EventAction:
+		return fmt.Sprintf("[%s] action: %s", e.Program, e.Action)
+	case EventError:
+		return fmt.Sprintf("[%s] error: %s", e.Program, e.Reason)
+	}
+	return e.Program + " " + e.Type
+}
+
+func programEvent(eventType, name string) Event {
+	return Event{
+		Type:    eventType,
+		Program: name,
+		Time:    time.Now(),
+	}
+}
+
+func (p *Process) stateEvent(oldState, newState FSMState) Event {
+	return Event{
+		Type:     EventState,
+		Program:  p.Name,
+		From:     oldState,
+		To:       newState,
+		Pid:      p.Pid,
+		ExitCode: p.ExitCode,
+		Expected: p.ExitSignal == "" && p.IsExpectedExit(p.ExitCode),
+		Reason:   p.stateReason(oldState, newState),
+		Time:     time.Now(),
+	}
+}
+
+// stateReason tells why the state changed
+func (p *Process) stateReason(oldState, newState FSMState) string {
+	if p.reason != "" {
+		reason := p.reason
+		p.reason = ""
+		return reason
+	}
+	exitReason := fmt.Sprintf("exit code %d", p.ExitCode)
+	if p.ExitSignal != "" {
+		exitReason = "killed by signal " + p.ExitSignal
+	}
+	switch newState {
+	case RetryWait, Exited:
+		return exitReason
+	case Fatal:
+		if oldState == RetryWait {
+			return "too many retries, last " + exitReason
+		}
+		return exitReason
+	case Unhealthy:
+		return p.HealthError
+	case Stopping:
+		return "stop requested"
+	case Running:
+		if oldState == RetryWait {
+			return "restarted"
+		}
+	}
+	return ""
+}
+
+// EventSkipped is sent instead of the events overwritten before the client got them
+const EventSkipped = "skipped"
+
+// eventReader reads the events for a client, optionally of one program
+type eventReader struct {
+	*Cursor
+	program string
+}
+
+// Next blocks until the next event, ok is false when the reader is closed
+func (er *eventReader) Next() (Event, bool) {
+	for {
+		value, seq, skipped, ok := er.Cursor.Next()
+		if !ok {
+			return Event{}, false
+		}
+		if skipped > 0 {
+			return Event{
+				Seq:    seq,
+				Type:   EventSkipped,
+				Reason: fmt.Sprintf("%d bytes skipped", skipped),
+				Time:   time.Now(),
+			}, true
+		}
+		e, ok := value.(Event)
+		if !ok || (er.program != "" && er.program != e.Program) {
+			continue
+		}
+		e.Seq = seq
+		return e, true
+	}
+}
+
+// newEventReader reads the events after ?after_seq=<seq> or header Last-Event-ID,
+// from now on if not set. ?program=<name> filters the events.
+// Not since, which is a time in the event history API.
+func (s *Supervisor) newEventReader(r *http.Request) *eventReader {
+	afterSeq := r.FormValue("after_seq")
+	if afterSeq == "" {
+		afterSeq = r.Header.Get("Last-Event-ID")
+	}
+	cursor := s.newEventCursor()
+	if seq, err := strconv.ParseUint(afterSeq, 10, 64); err == nil {
+		cursor.Close()
+		cursor = s.eventB.NewCursor(seq)
+	}
+	return &eventReader{
+		Cursor:  cursor,
+		program: r.FormValue("program"),
+	}
+}
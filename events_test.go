@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEventStream(t *testing.T) {
+	Convey("Events should be sent as Server-Sent Events", t, func() {
+		s := &Supervisor{eventB: NewWriteBroadcaster(4096)}
+		ts := httptest.NewServer(http.HandlerFunc(s.hEventStream))
+		defer ts.Close()
+
+		s.broadcastEvent(programEvent(EventAdded, "web"))
+		s.broadcastEvent(Event{Type: EventState, Program: "db", From: Stopped, To: Running, Pid: 10})
+		s.broadcastEvent(Event{Type: EventState, Program: "web", From: Stopped, To: Running, Pid: 12})
+
+		req, _ := http.NewRequest("GET", ts.URL+"?program=web", nil)
+		req.Header.Set("Last-Event-ID", "1")
+		resp, err := http.DefaultClient.Do(req)
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		So(resp.Header.Get("Content-Type"), ShouldEqual, "text/event-stream")
+
+		reader := bufio.NewReader(resp.Body)
+		readLine := func() string {
+			line, _ := reader.ReadString('\n')
+			return strings.TrimSuffix(line, "\n")
+		}
+		So(readLine(), ShouldEqual, "id: 3")
+		So(readLine(), ShouldEqual, "event: state")
+		data := readLine()
+		So(data, ShouldStartWith, "data: ")
+		var e Event
+		So(json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &e), ShouldBeNil)
+		So(e.Program, ShouldEqual, "web")
+		So(e.To, ShouldEqual, Running)
+		So(e.Pid, ShouldEqual, 12)
+		So(e.Seq, ShouldEqual, 3)
+		So(readLine(), ShouldEqual, "")
+
+		s.broadcastEvent(programEvent(EventDeleted, "web"))
+		So(readLine(), ShouldEqual, "id: 4")
+		So(readLine(), ShouldEqual, "event: deleted")
+
+		Convey("after_seq should resume like Last-Event-ID", func() {
+			resp, err := http.Get(ts.URL + "?after_seq=3")
+			So(err, ShouldBeNil)
+			defer resp.Body.Close()
+			reader := bufio.NewReader(resp.Body)
+			line, _ := reader.ReadString('\n')
+			So(line, ShouldEqual, "id: 4\n")
+		})
+	})
+
+	Convey("State change should tell the reason", t, func() {
+		p := NewProcess(Program{Name: "web", Command: "echo"})
+		p.ExitCode = 2
+		e := p.stateEvent(Running, RetryWait)
+		So(e.Reason, ShouldEqual, "exit code 2")
+		So(e.Expected, ShouldBeFalse)
+		So(e.String(), ShouldEqual, "[web] state: running -> retry wait")
+
+		p.ExitSignal = "killed"
+		So(p.stateEvent(RetryWait, Fatal).Reason, ShouldEqual, "too many retries, last killed by signal killed")
+
+		p.reason = "start failed: no such file"
+		So(p.stateEvent(Stopped, Fatal).Reason, ShouldEqual, "start failed: no such file")
+		So(p.stateEvent(Stopped, Fatal).Reason, ShouldEqual, "killed by signal killed")
+	})
+}
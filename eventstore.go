@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const eventsFileName = "events.log"
+
+// EventStore appends the events to <logpath>/events.log as json lines,
+// the file is rotated and the old files are removed by the retention policy.
+type EventStore struct {
+	filename string
+	w        *RotateWriter
+}
+
+func NewEventStore(filename string, retention LogRotate) (*EventStore, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return nil, err
+	}
+	w, err := NewRotateWriter(filename, retention)
+	if err != nil {
+		return nil, err
+	}
+	return &EventStore{filename: filename, w: w}, nil
+}
+
+func (es *EventStore) Append(e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = es.w.Write(append(data, '\n'))
+	return err
+}
+
+func (es *EventStore) Close() error {
+	return es.w.Close()
+}
+
+// EventQuery filters the stored events, zero values match all
+type EventQuery struct {
+	Program string
+	Type    string
+	Since   time.Time
+	Until   time.Time
+	Limit   int // only the latest events
+}
+
+func (q EventQuery) Match(e Event) bool {
+	if q.Program != "" && q.Program != e.Program {
+		return false
+	}
+	if q.Type != "" && q.Type != e.Type {
+		return false
+	}
+	if !q.Since.IsZero() && e.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && e.Time.After(q.Until) {
+		return false
+	}
+	return true
+}
+
+// Query returns the matched events, oldest first
+func (es *EventStore) Query(q EventQuery) ([]Event, error) {
+	files := rotatedFiles(es.filename)
+	events := make([]Event, 0)
+	for i := len(files) - 1; i >= 0; i-- {
+		// rotated files only have events before the rotate time
+		if rotated, _, ok := parseRotated(strings.TrimPrefix(files[i], es.filename+".")); ok && rotated.Before(q.Since) {
+			continue
+		}
+		// the file may be removed or compressed by the rotation meanwhile
+		if err := readEvents(files[i], q, &events); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	if err := readEvents(es.filename, q, &events); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if q.Limit > 0 && len(events) > q.Limit {
+		events = events[len(events)-q.Limit:]
+	}
+	return events, nil
+}
+
+func readEvents(filename string, q EventQuery, events *[]Event) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(filename, ".gz") {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var e Event
+		if json.Unmarshal(scanner.Bytes(), &e) != nil {
+			continue
+		}
+		if q.Match(e) {
+			*events = append(*events, e)
+		}
+	}
+	return scanner.Err()
+}
+
+// parseTimeArg parses RFC3339 time, or duration before now, eg: 2h
+func parseTimeArg(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %s, should be RFC3339 like 2017-12-04T16:15:00+08:00 or duration like 2h", s)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEventStore(t *testing.T) {
+	Convey("Events should be saved and queried across rotated files", t, func() {
+		dir, err := ioutil.TempDir("", "gosuv")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		es, err := NewEventStore(filepath.Join(dir, eventsFileName), LogRotate{Compress: true})
+		So(err, ShouldBeNil)
+		defer es.Close()
+
+		now := time.Now()
+		es.Append(Event{Seq: 1, Type: EventState, Program: "web", From: Stopped, To: Running, Time: now.Add(-3 * time.Hour)})
+		es.Append(Event{Seq: 2, Type: EventAction, Program: "web", Action: "stop", Source: "admin@127.0.0.1", Time: now.Add(-2 * time.Hour)})
+		So(es.w.Rotate(), ShouldBeNil)
+		time.Sleep(100 * time.Millisecond) // wait for compress
+		es.Append(Event{Seq: 3, Type: EventState, Program: "web", From: Running, To: Stopped, Time: now.Add(-time.Hour)})
+		es.Append(Event{Seq: 4, Type: EventState, Program: "worker", From: Stopped, To: Running, Time: now})
+
+		events, err := es.Query(EventQuery{})
+		So(err, ShouldBeNil)
+		So(len(events), ShouldEqual, 4)
+		So(events[0].Seq, ShouldEqual, 1)
+		So(events[1].Action, ShouldEqual, "stop")
+		So(events[3].Seq, ShouldEqual, 4)
+
+		events, _ = es.Query(EventQuery{Program: "web", Type: EventState})
+		So(len(events), ShouldEqual, 2)
+		So(events[1].To, ShouldEqual, Stopped)
+
+		events, _ = es.Query(EventQuery{Since: now.Add(-150 * time.Minute), Until: now.Add(-30 * time.Minute)})
+		So(len(events), ShouldEqual, 2)
+		So(events[0].Seq, ShouldEqual, 2)
+
+		events, _ = es.Query(EventQuery{Limit: 1})
+		So(len(events), ShouldEqual, 1)
+		So(events[0].Seq, ShouldEqual, 4)
+	})
+
+	Convey("Time argument should accept RFC3339 and duration", t, func() {
+		tm, err := parseTimeArg("2017-12-04T16:15:00+08:00")
+		So(err, ShouldBeNil)
+		So(tm.Unix(), ShouldEqual, 1512375300)
+		tm, err = parseTimeArg("2h")
+		So(err, ShouldBeNil)
+		So(time.Since(tm), ShouldBeGreaterThanOrEqualTo, 2*time.Hour)
+		_, err = parseTimeArg("yesterday")
+		So(err, ShouldNotBeNil)
+	})
+}
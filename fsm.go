@@ -21,13 +21,16 @@ import (
 	log "github.com/cihub/seelog"
 )
 
-// Only 4 states now is enough
+// States, ref: http://supervisord.org/subprocess.html#process-states
 var (
 	Running   = FSMState("running")
 	Stopped   = FSMState("stopped")
 	Fatal     = FSMState("fatal")
 	RetryWait = FSMState("retry wait")
 	Stopping  = FSMState("stopping")
+	Exited    = FSMState("exited")    // quit by itself and not restarted
+	Healthy   = FSMState("healthy")   // running and health check passed
+	Unhealthy = FSMState("unhealthy") // running but health check failed, going to restart
 
 	StartEvent   = FSMEvent("start")
 	StopEvent    = FSMEvent("stop")
@@ -35,11 +38,18 @@ var (
 )
 
 type FSMState string
+
+// isUp reports whether the program process is alive in the state
+func isUp(state FSMState) bool {
+	return state == Running || state == Healthy || state == Unhealthy
+}
+
 type FSMEvent string
 type FSMHandler func()
 
 type FSM struct {
-	mu       sync.Mutex
+	mu       sync.Mutex   // held while handling an event
+	stateMu  sync.RWMutex // state is read and set out of Operate too
 	state    FSMState
 	handlers map[FSMState]map[FSMEvent]FSMHandler
 
@@ -62,14 +72,18 @@ func (f *FSM) AddHandler(state FSMState, event FSMEvent, hdlr FSMHandler) *FSM {
 }
 
 func (f *FSM) State() FSMState {
+	f.stateMu.RLock()
+	defer f.stateMu.RUnlock()
 	return f.state
 }
 
 func (f *FSM) SetState(newState FSMState) {
 	if f.StateChange != nil {
-		f.StateChange(f.state, newState)
+		f.StateChange(f.State(), newState)
 	}
+	f.stateMu.Lock()
 	f.state = newState
+	f.stateMu.Unlock()
 }
 
 func (f *FSM) Operate(event FSMEvent) FSMState {
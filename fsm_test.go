@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"testing"
 	"time"
@@ -36,3 +38,168 @@ func TestStopCommand(t *testing.T) {
 		So(exists, ShouldBeFalse)
 	})
 }
+
+func TestStopSequence(t *testing.T) {
+	Convey("Stop sequence should escalate signals in order", t, func() {
+		p := NewProcess(Program{
+			Name:    "trap",
+			Command: "trap 'echo ignore' TERM; trap 'exit 3' INT; while true; do sleep 0.1; done",
+			StopSequence: []StopStep{
+				{Signal: "TERM", Wait: 1},
+				{Signal: "SIGINT", Wait: 5},
+			},
+		})
+		p.startCommand()
+		time.Sleep(100 * time.Millisecond)
+		start := time.Now()
+		p.stopCommand()
+		So(p.cmd, ShouldBeNil)
+		So(p.State(), ShouldEqual, Stopped)
+		So(time.Since(start), ShouldBeBetween, time.Second, 3*time.Second)
+	})
+}
+
+func TestExitCodes(t *testing.T) {
+	Convey("Program exit with expected code should not restart", t, func() {
+		p := NewProcess(Program{
+			Name:         "exit0",
+			Command:      "exit 0",
+			StartRetries: 3,
+		})
+		p.Operate(StartEvent)
+		time.Sleep(500 * time.Millisecond)
+		So(p.State(), ShouldEqual, Exited)
+		So(p.ExitCode, ShouldEqual, 0)
+		So(p.ExitTime, ShouldNotBeNil)
+		So(p.cmd, ShouldBeNil)
+	})
+
+	Convey("Program exit with unexpected code should restart", t, func() {
+		p := NewProcess(Program{
+			Name:      "exit2",
+			Command:   "exit 2",
+			ExitCodes: []int{0, 1},
+		})
+		p.Operate(StartEvent)
+		time.Sleep(500 * time.Millisecond)
+		So(p.State(), ShouldEqual, Fatal)
+		So(p.ExitCode, ShouldEqual, 2)
+	})
+
+	Convey("Stop in retry wait should not stop the exited command again", t, func() {
+		p := NewProcess(Program{
+			Name:         "retrywait",
+			Command:      "exit 3",
+			StartRetries: 3,
+			Backoff:      Backoff{Delay: 10},
+		})
+		before, _ := p.Runs(100)
+		p.Operate(StartEvent)
+		time.Sleep(500 * time.Millisecond)
+		So(p.State(), ShouldEqual, RetryWait)
+		exitTime := p.ExitTime
+		p.Operate(StopEvent)
+		time.Sleep(100 * time.Millisecond)
+		So(p.State(), ShouldEqual, Stopped)
+		So(p.NextRetry, ShouldBeNil)
+		So(p.cmd, ShouldBeNil)
+		So(p.ExitTime, ShouldEqual, exitTime)
+		So(p.ExitCode, ShouldEqual, 3)
+		runs, err := p.Runs(100)
+		So(err, ShouldBeNil)
+		So(len(runs), ShouldEqual, len(before)+1)
+		data, err := ioutil.ReadFile(p.StderrLogPath())
+		So(err, ShouldBeNil)
+		So(string(data), ShouldNotContainSubstring, "exit fail")
+	})
+
+	Convey("Autorestart policy", t, func() {
+		pg := Program{AutoRestart: AutoRestartAlways}
+		So(pg.ShouldRestart(0, false), ShouldBeTrue)
+		pg.AutoRestart = AutoRestartNever
+		So(pg.ShouldRestart(1, true), ShouldBeFalse)
+		pg.AutoRestart = AutoRestartUnexpected
+		So(pg.ShouldRestart(0, false), ShouldBeFalse)
+		So(pg.ShouldRestart(0, true), ShouldBeTrue)
+	})
+}
+
+func TestOneshotRuns(t *testing.T) {
+	Convey("Oneshot program should not restart and record runs", t, func() {
+		p := NewProcess(Program{
+			Name:         "oneshot",
+			Command:      "echo run; exit 4",
+			Type:         ProgramOneshot,
+			StartRetries: 3,
+		})
+		p.Operate(StartEvent)
+		time.Sleep(300 * time.Millisecond)
+		So(p.State(), ShouldEqual, Fatal)
+		p.Operate(StartEvent)
+		time.Sleep(300 * time.Millisecond)
+
+		runs, err := p.Runs(10)
+		So(err, ShouldBeNil)
+		So(len(runs), ShouldEqual, 2)
+		So(runs[0].ExitCode, ShouldEqual, 4)
+		So(runs[0].StartTime, ShouldHappenAfter, runs[1].StartTime)
+	})
+}
+
+func TestHealthCheck(t *testing.T) {
+	Convey("Unhealthy program should be restarted", t, func() {
+		p := NewProcess(Program{
+			Name:    "unhealthy",
+			Command: "sleep 10",
+			HealthCheck: HealthCheck{
+				Exec:             "test -f /nonexist",
+				Interval:         1,
+				FailureThreshold: 2,
+			},
+		})
+		states := make(chan FSMState, 10)
+		p.StateChange = func(_, newState FSMState) {
+			states <- newState
+		}
+		p.Operate(StartEvent)
+		So(<-states, ShouldEqual, Running)
+		So(<-states, ShouldEqual, Unhealthy)
+		So(<-states, ShouldEqual, Stopping)
+		So(<-states, ShouldEqual, Stopped)
+		So(<-states, ShouldEqual, Running)
+		p.Operate(StopEvent)
+	})
+}
+
+func TestLogFiles(t *testing.T) {
+	Convey("Stdout and stderr should go to their own log file", t, func() {
+		p := NewProcess(Program{
+			Name:          "streams",
+			Command:       "echo out; echo err >&2",
+			Type:          ProgramOneshot,
+			StderrLogfile: "error.log",
+		})
+		p.Operate(StartEvent)
+		time.Sleep(300 * time.Millisecond)
+		So(p.State(), ShouldEqual, Exited)
+
+		stdout, _ := ioutil.ReadFile(p.StdoutLogPath())
+		stderr, _ := ioutil.ReadFile(filepath.Join(p.logDir(), "error.log"))
+		So(string(stdout), ShouldEqual, "out\n")
+		So(string(stderr), ShouldStartWith, "err\n")
+
+		Convey("redirect_stderr should merge them", func() {
+			p := NewProcess(Program{
+				Name:           "redirect",
+				Command:        "echo out; echo err >&2",
+				Type:           ProgramOneshot,
+				RedirectStderr: true,
+			})
+			p.Operate(StartEvent)
+			time.Sleep(300 * time.Millisecond)
+			So(p.StderrLogPath(), ShouldEqual, p.StdoutLogPath())
+			stdout, _ := ioutil.ReadFile(p.StdoutLogPath())
+			So(string(stdout), ShouldStartWith, "out\nerr\n")
+		})
+	})
+}
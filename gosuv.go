@@ -10,6 +10,16 @@ import (
 
 var cl = &Client{}
 
+var selectorFlag = cli.StringFlag{
+	Name:  "selector, l",
+	Usage: "filter programs by labels, eg: team=payments,tier!=db",
+}
+
+var groupFlag = cli.StringFlag{
+	Name:  "group, g",
+	Usage: "only programs in the group",
+}
+
 func main() {
 
 	//初始global 变量
@@ -32,7 +42,7 @@ func main() {
 		}
 		Cfg, err = readConf(CfgFile)
 		if err != nil {
-			fmt.Printf("read conf failed,", err)
+			fmt.Printf("read conf failed, %v\n", err)
 			os.Exit(-1)
 		}
 		//加载client配置
@@ -73,6 +83,7 @@ func main() {
 			Name:    "status",
 			Aliases: []string{"st"},
 			Usage:   "Show program status",
+			Flags:   []cli.Flag{groupFlag, selectorFlag},
 			Action:  actionProgramStatus,
 		},
 		{
@@ -82,18 +93,135 @@ func main() {
 			Action:  actionStatus,
 		},
 		{
-			Name:   "start",
-			Usage:  "Start program",
-			Action: actionStart,
+			Name:      "start",
+			Usage:     "Start program",
+			ArgsUsage: "<name|all|pattern>",
+			Flags:     []cli.Flag{groupFlag, selectorFlag},
+			Action:    actionStart,
+		},
+		{
+			Name:      "stop",
+			Usage:     "Stop program",
+			ArgsUsage: "<name|all|pattern>",
+			Flags:     []cli.Flag{groupFlag, selectorFlag},
+			Action:    actionStop,
+		},
+		{
+			Name:      "restart",
+			Usage:     "Restart program, start it if not running",
+			ArgsUsage: "<name|all|pattern>",
+			Flags: []cli.Flag{
+				groupFlag,
+				selectorFlag,
+				cli.BoolFlag{
+					Name:  "rolling",
+					Usage: "restart batch at a time, wait every instance ready before the next batch, abort if one fails",
+				},
+				cli.IntFlag{
+					Name:  "batch",
+					Usage: "instances restarted at a time of rolling restart",
+					Value: 1,
+				},
+			},
+			Action: actionRestartProgram,
+		},
+		{
+			Name:      "signal",
+			Usage:     "Send signal to program, eg: gosuv signal nginx HUP",
+			ArgsUsage: "<name|all|pattern> <signal>",
+			Flags:     []cli.Flag{groupFlag, selectorFlag},
+			Action:    actionSignal,
+		},
+		{
+			Name:      "scale",
+			Usage:     "Change numprocs of program, eg: gosuv scale worker 4",
+			ArgsUsage: "<name> <numprocs>",
+			Action:    actionScale,
+		},
+		{
+			Name:  "tail",
+			Usage: "Show program log",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "follow, f",
+					Usage: "keep printing the new output",
+				},
+				cli.IntFlag{
+					Name:  "n",
+					Usage: "number of lines to show",
+					Value: 10,
+				},
+				cli.BoolFlag{
+					Name:  "stderr",
+					Usage: "show stderr log",
+				},
+			},
+			Action: actionTail,
+		},
+		{
+			Name:  "runs",
+			Usage: "Show run history of program",
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "n",
+					Usage: "number of runs to show",
+					Value: 20,
+				},
+			},
+			Action: actionRuns,
+		},
+		{
+			Name:      "events",
+			Usage:     "Show event history",
+			ArgsUsage: "[program]",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "since",
+					Usage: "show events after time, RFC3339 or duration before now, eg: 2h",
+				},
+				cli.StringFlag{
+					Name:  "until",
+					Usage: "show events before time, RFC3339 or duration before now",
+				},
+				cli.StringFlag{
+					Name:  "type",
+					Usage: "event type: state, added, updated, deleted, action",
+				},
+				cli.IntFlag{
+					Name:  "n",
+					Usage: "number of events to show",
+					Value: 50,
+				},
+			},
+			Action: actionEvents,
+		},
+		{
+			Name:      "silence",
+			Usage:     "Suppress notifications of program, list silences without arguments",
+			ArgsUsage: "[<program> <duration>]",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "comment, m",
+					Usage: "why the program is silenced",
+				},
+			},
+			Action: actionSilence,
 		},
 		{
-			Name:   "stop",
-			Usage:  "Stop program",
-			Action: actionStop,
+			Name:      "unsilence",
+			Usage:     "Remove silence",
+			ArgsUsage: "<silence id>",
+			Action:    actionUnsilence,
 		},
 		{
-			Name:   "reload",
-			Usage:  "Reload config file",
+			Name:  "reload",
+			Usage: "Reload config file",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "dry-run, n",
+					Usage: "only show what would change",
+				},
+			},
 			Action: actionReload,
 		},
 		{
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/codeskyblue/kexec"
+)
+
+// HealthCheck probes a running program, only one of HTTP, TCP and Exec should be set.
+// After FailureThreshold failures in a row the program is restarted.
+type HealthCheck struct {
+	HTTP             string `yaml:"http,omitempty" json:"http"` // GET url, 2xx and 3xx is healthy
+	TCP              string `yaml:"tcp,omitempty" json:"tcp"`   // host:port
+	Exec             string `yaml:"exec,omitempty" json:"exec"` // shell command, exit 0 is healthy
+	Interval         int    `yaml:"interval,omitempty" json:"interval"`
+	Timeout          int    `yaml:"timeout,omitempty" json:"timeout"`
+	FailureThreshold int    `yaml:"failure_threshold,omitempty" json:"failureThreshold"`
+}
+
+func (h HealthCheck) Enabled() bool {
+	return h.HTTP != "" || h.TCP != "" || h.Exec != ""
+}
+
+func (h HealthCheck) Check() error {
+	n := 0
+	for _, probe := range []string{h.HTTP, h.TCP, h.Exec} {
+		if probe != "" {
+			n++
+		}
+	}
+	if n > 1 {
+		return errors.New("healthcheck: only one of http, tcp and exec can be set")
+	}
+	return nil
+}
+
+func (h HealthCheck) interval() time.Duration {
+	if h.Interval <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(h.Interval) * time.Second
+}
+
+func (h HealthCheck) timeout() time.Duration {
+	if h.Timeout <= 0 {
+		return 3 * time.Second
+	}
+	return time.Duration(h.Timeout) * time.Second
+}
+
+func (h HealthCheck) threshold() int {
+	if h.FailureThreshold <= 0 {
+		return 3
+	}
+	return h.FailureThreshold
+}
+
+// Probe runs the check once, nil means healthy
+func (h HealthCheck) Probe(dir string) error {
+	switch {
+	case h.HTTP != "":
+		client := &http.Client{Timeout: h.timeout()}
+		resp, err := client.Get(h.HTTP)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			return fmt.Errorf("http status %d", resp.StatusCode)
+		}
+	case h.TCP != "":
+		conn, err := net.DialTimeout("tcp", h.TCP, h.timeout())
+		if err != nil {
+			return err
+		}
+		conn.Close()
+	case h.Exec != "":
+		cmd := kexec.CommandString(h.Exec)
+		cmd.Dir = dir
+		return runTimeout(cmd, h.timeout(), syscall.SIGKILL)
+	}
+	return nil
+}
+
+// watchHealth probes the program until done is closed,
+// and restart it after too many failures
+func (p *Process) watchHealth(done chan struct{}) {
+	hc := p.HealthCheck
+	ticker := time.NewTicker(hc.interval())
+	defer ticker.Stop()
+	failures := 0
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		err := hc.Probe(p.Dir)
+		if err == nil {
+			failures = 0
+			p.setHealth(Healthy, 0, "")
+			continue
+		}
+		failures++
+		log.Warnf("[%s] health check failed %d/%d: %v", p.Name, failures, hc.threshold(), err)
+		if failures < hc.threshold() {
+			p.setHealth("", failures, err.Error())
+			continue
+		}
+		if p.setHealth(Unhealthy, failures, err.Error()) {
+			log.Warnf("[%s] unhealthy, restart", p.Name)
+			p.Operate(RestartEvent)
+		}
+		return
+	}
+}
+
+// setHealth updates health info, state is changed only when the program is up.
+// returns false if the program is not up any more
+func (p *Process) setHealth(state FSMState, failures int, errMsg string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !isUp(p.State()) {
+		return false
+	}
+	p.HealthFailures = failures
+	p.HealthError = errMsg
+	if state != "" && p.State() != state {
+		p.SetState(state)
+	}
+	return true
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestProbe(t *testing.T) {
+	Convey("Timed out exec probe should be killed and waited", t, func() {
+		dir, err := ioutil.TempDir("", "gosuv")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		pidFile := filepath.Join(dir, "pid")
+		start := time.Now()
+		err = HealthCheck{Exec: "echo $$ > " + pidFile + "; sleep 10", Timeout: 1}.Probe(dir)
+		So(err, ShouldEqual, ErrCommandTimeout)
+		So(time.Since(start), ShouldBeLessThan, 3*time.Second)
+
+		data, err := ioutil.ReadFile(pidFile)
+		So(err, ShouldBeNil)
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		So(err, ShouldBeNil)
+		// a zombie still accepts signal 0
+		So(syscall.Kill(pid, 0), ShouldEqual, syscall.ESRCH)
+
+		So(HealthCheck{Exec: "exit 1"}.Probe(dir), ShouldNotBeNil)
+		So(HealthCheck{Exec: "true"}.Probe(dir), ShouldBeNil)
+	})
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// webhook categories, POST /webhooks/<name>/<category>
+const (
+	HookGithub  = "github"  // header X-Hub-Signature-256
+	HookGitlab  = "gitlab"  // header X-Gitlab-Token
+	HookGitea   = "gitea"   // header X-Gitea-Signature
+	HookGeneric = "generic" // header Authorization: Bearer <secret>
+)
+
+// what to do when the deploy fails, see WebHook.OnFailure
+const (
+	HookFailureRestart  = "restart"
+	HookFailureStop     = "stop"
+	HookFailureRollback = "rollback"
+)
+
+var errHookSignature = errors.New("webhook signature mismatch")
+
+// WebHook runs Command when the repository is pushed, eg: to pull the code and rebuild.
+// Only the categories with a secret are enabled.
+type WebHook struct {
+	Github   HookSecret `yaml:"github,omitempty"`
+	Gitlab   HookSecret `yaml:"gitlab,omitempty"`
+	Gitea    HookSecret `yaml:"gitea,omitempty"`
+	Generic  HookSecret `yaml:"generic,omitempty"`
+	Branches []string   `yaml:"branches,omitempty"` // only pushes to these branches trigger, glob supported, default all
+	Command  string     `yaml:"command"`
+	Timeout  int        `yaml:"timeout"`  // seconds, default 600
+	Rollback string     `yaml:"rollback"` // command to run when the deploy fails
+	// restart: start the program anyway, stop: keep the program stopped,
+	// rollback: run rollback and start the program if it succeeds.
+	// Default rollback if set, otherwise restart
+	OnFailure string `yaml:"on_failure"`
+}
+
+type HookSecret struct {
+	Secret string `yaml:"secret"`
+}
+
+func (h WebHook) Check() error {
+	for _, branch := range h.Branches {
+		if _, err := path.Match(branch, ""); err != nil {
+			return fmt.Errorf("webhook: invalid branch %s", branch)
+		}
+	}
+	switch h.OnFailure {
+	case "", HookFailureRestart, HookFailureStop:
+	case HookFailureRollback:
+		if h.Rollback == "" {
+			return errors.New("webhook: on_failure rollback requires rollback command")
+		}
+	default:
+		return fmt.Errorf("webhook: unknown on_failure %s", h.OnFailure)
+	}
+	return nil
+}
+
+func (h WebHook) onFailure() string {
+	if h.OnFailure != "" {
+		return h.OnFailure
+	}
+	if h.Rollback != "" {
+		return HookFailureRollback
+	}
+	return HookFailureRestart
+}
+
+func (h WebHook) timeout() time.Duration {
+	if h.Timeout <= 0 {
+		return 10 * time.Minute
+	}
+	return time.Duration(h.Timeout) * time.Second
+}
+
+func (h WebHook) secret(category string) (string, error) {
+	var hs HookSecret
+	switch category {
+	case HookGithub:
+		hs = h.Github
+	case HookGitlab:
+		hs = h.Gitlab
+	case HookGitea:
+		hs = h.Gitea
+	case HookGeneric:
+		hs = h.Generic
+	default:
+		return "", fmt.Errorf("unknown webhook category: %s", category)
+	}
+	if hs.Secret == "" {
+		return "", fmt.Errorf("webhook %s not enabled, secret required", category)
+	}
+	return hs.Secret, nil
+}
+
+// Verify checks the request was signed with the secret of category
+func (h WebHook) Verify(category string, header http.Header, body []byte) error {
+	secret, err := h.secret(category)
+	if err != nil {
+		return err
+	}
+	var ok bool
+	switch category {
+	case HookGithub:
+		ok = validHMAC(secret, body, strings.TrimPrefix(header.Get("X-Hub-Signature-256"), "sha256="))
+	case HookGitea:
+		ok = validHMAC(secret, body, header.Get("X-Gitea-Signature"))
+	case HookGitlab:
+		ok = equalSecret(header.Get("X-Gitlab-Token"), secret)
+	case HookGeneric:
+		ok = equalSecret(strings.TrimPrefix(header.Get("Authorization"), "Bearer "), secret)
+	}
+	if !ok {
+		return errHookSignature
+	}
+	return nil
+}
+
+// MatchRef reports whether the pushed ref(eg: refs/heads/master) is one of the branches
+func (h WebHook) MatchRef(ref string) bool {
+	if len(h.Branches) == 0 {
+		return true
+	}
+	if !strings.HasPrefix(ref, "refs/heads/") {
+		return false
+	}
+	branch := strings.TrimPrefix(ref, "refs/heads/")
+	for _, pattern := range h.Branches {
+		if ok, _ := path.Match(pattern, branch); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hookRef returns the ref of the push payload, github, gitlab and gitea all have the field ref
+func hookRef(body []byte) string {
+	var payload struct {
+		Ref string `json:"ref"`
+	}
+	json.Unmarshal(body, &payload)
+	return payload.Ref
+}
+
+func validHMAC(secret string, body []byte, signature string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil || len(expected) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+func equalSecret(given, secret string) bool {
+	return given != "" && subtle.ConstantTimeCompare([]byte(given), []byte(secret)) == 1
+}
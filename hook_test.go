@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWebHook(t *testing.T) {
+	body := []byte(`{"ref":"refs/heads/release-1.2","after":"0d1a26e6"}`)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	Convey("Request should be verified by the secret of category", t, func() {
+		hook := WebHook{}
+		hook.Github.Secret = "s3cret"
+		hook.Gitlab.Secret = "s3cret"
+		hook.Gitea.Secret = "s3cret"
+		hook.Generic.Secret = "s3cret"
+
+		header := http.Header{}
+		header.Set("X-Hub-Signature-256", "sha256="+signature)
+		So(hook.Verify(HookGithub, header, body), ShouldBeNil)
+		So(hook.Verify(HookGithub, header, []byte(`{"ref":"refs/heads/master"}`)), ShouldEqual, errHookSignature)
+		So(hook.Verify(HookGithub, http.Header{}, body), ShouldEqual, errHookSignature)
+
+		header = http.Header{}
+		header.Set("X-Gitea-Signature", signature)
+		So(hook.Verify(HookGitea, header, body), ShouldBeNil)
+
+		header = http.Header{}
+		header.Set("X-Gitlab-Token", "s3cret")
+		So(hook.Verify(HookGitlab, header, body), ShouldBeNil)
+		header.Set("X-Gitlab-Token", "guess")
+		So(hook.Verify(HookGitlab, header, body), ShouldEqual, errHookSignature)
+
+		header = http.Header{}
+		header.Set("Authorization", "Bearer s3cret")
+		So(hook.Verify(HookGeneric, header, body), ShouldBeNil)
+		So(hook.Verify(HookGeneric, http.Header{}, body), ShouldEqual, errHookSignature)
+
+		So(hook.Verify("bitbucket", header, body), ShouldNotBeNil)
+	})
+
+	Convey("Category without secret should be disabled", t, func() {
+		header := http.Header{}
+		header.Set("X-Hub-Signature-256", "sha256="+signature)
+		err := WebHook{}.Verify(HookGithub, header, body)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "secret required")
+	})
+
+	Convey("Only pushes to the branches should trigger", t, func() {
+		So(hookRef(body), ShouldEqual, "refs/heads/release-1.2")
+		So(WebHook{}.MatchRef(""), ShouldBeTrue)
+
+		hook := WebHook{Branches: []string{"master", "release-*"}}
+		So(hook.Check(), ShouldBeNil)
+		So(hook.MatchRef("refs/heads/master"), ShouldBeTrue)
+		So(hook.MatchRef("refs/heads/release-1.2"), ShouldBeTrue)
+		So(hook.MatchRef("refs/heads/dev"), ShouldBeFalse)
+		So(hook.MatchRef("refs/tags/master"), ShouldBeFalse)
+		So(hook.MatchRef(""), ShouldBeFalse)
+
+		So(WebHook{Branches: []string{"[master"}}.Check(), ShouldNotBeNil)
+	})
+}
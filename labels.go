@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Selector matches the labels of program, terms are separated by comma and all should match.
+// eg: team=payments,tier!=db,canary (has label canary)
+type Selector []selectorTerm
+
+type selectorTerm struct {
+	Key   string
+	Op    string // =, != or empty for exists
+	Value string
+}
+
+func ParseSelector(s string) (Selector, error) {
+	sel := Selector{}
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		t := selectorTerm{Key: term}
+		if idx := strings.Index(term, "!="); idx >= 0 {
+			t = selectorTerm{Key: term[:idx], Op: "!=", Value: term[idx+2:]}
+		} else if idx := strings.Index(term, "="); idx >= 0 {
+			t = selectorTerm{Key: term[:idx], Op: "=", Value: term[idx+1:]}
+		}
+		t.Key, t.Value = strings.TrimSpace(t.Key), strings.TrimSpace(t.Value)
+		if t.Key == "" {
+			return nil, fmt.Errorf("invalid selector %s, should be like key=value,key2!=value2", s)
+		}
+		sel = append(sel, t)
+	}
+	return sel, nil
+}
+
+func (sel Selector) Matches(labels map[string]string) bool {
+	for _, t := range sel {
+		value, ok := labels[t.Key]
+		switch t.Op {
+		case "=":
+			if !ok || value != t.Value {
+				return false
+			}
+		case "!=":
+			if ok && value == t.Value {
+				return false
+			}
+		default:
+			if !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// LogLine is one line of program output
+type LogLine struct {
+	Seq    uint64    `json:"seq"`
+	Stream string    `json:"stream"` // stdout or stderr
+	Time   time.Time `json:"time"`
+	Text   string    `json:"text"` // without the line break
+}
+
+// LineBroadcaster splits the output into whole lines, numbers them and
+// keeps the latest lines in a Ring. Every subscriber reads at its own cursor,
+// so a reconnected client can resume from the last sequence number it got.
+type LineBroadcaster struct {
+	*Ring
+	mu         sync.Mutex
+	maxLineLen int
+	partial    map[string][]byte // unfinished line of every stream
+}
+
+func NewLineBroadcaster(size, maxLineLen int) *LineBroadcaster {
+	return &LineBroadcaster{
+		Ring:       NewRing(size),
+		maxLineLen: maxLineLen,
+		partial:    make(map[string][]byte),
+	}
+}
+
+// Writer returns a writer whose output is tagged with stream
+func (b *LineBroadcaster) Writer(stream string) io.Writer {
+	return &lineWriter{b: b, stream: stream}
+}
+
+type lineWriter struct {
+	b      *LineBroadcaster
+	stream string
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.b.write(w.stream, p)
+	return len(p), nil
+}
+
+func (b *LineBroadcaster) write(stream string, p []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	buf := append(b.partial[stream], p...)
+	for {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			break
+		}
+		b.emitLong(stream, bytes.TrimSuffix(buf[:i], []byte("\r")))
+		buf = buf[i+1:]
+	}
+	for b.maxLineLen > 0 && len(buf) >= b.maxLineLen {
+		b.emit(stream, buf[:b.maxLineLen])
+		buf = buf[b.maxLineLen:]
+	}
+	b.partial[stream] = append([]byte(nil), buf...)
+}
+
+// emitLong splits line longer than maxLineLen
+func (b *LineBroadcaster) emitLong(stream string, line []byte) {
+	for b.maxLineLen > 0 && len(line) > b.maxLineLen {
+		b.emit(stream, line[:b.maxLineLen])
+		line = line[b.maxLineLen:]
+	}
+	b.emit(stream, line)
+}
+
+func (b *LineBroadcaster) emit(stream string, text []byte) {
+	// Seq is filled by the subscriber from the ring
+	b.Put(&LogLine{
+		Stream: stream,
+		Time:   time.Now(),
+		Text:   string(text),
+	}, len(text)+1)
+}
+
+// Flush sends the unfinished lines, called when the program quits
+func (b *LineBroadcaster) Flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for stream, buf := range b.partial {
+		if len(buf) > 0 {
+			b.emit(stream, buf)
+		}
+		delete(b.partial, stream)
+	}
+}
+
+// LineSubscriber reads the lines of one stream, empty means all
+type LineSubscriber struct {
+	*Cursor
+	stream string
+}
+
+// Subscribe returns a subscriber reading the lines whose seq is bigger than afterSeq
+func (b *LineBroadcaster) Subscribe(afterSeq uint64, stream string) *LineSubscriber {
+	return &LineSubscriber{
+		Cursor: b.NewCursor(afterSeq),
+		stream: stream,
+	}
+}
+
+// Next blocks until the next line. When the subscriber is too slow and
+// lines were overwritten, a "bytes skipped" line of stream gosuv is returned.
+func (s *LineSubscriber) Next() (LogLine, bool) {
+	for {
+		value, seq, skipped, ok := s.Cursor.Next()
+		if !ok {
+			return LogLine{}, false
+		}
+		if skipped > 0 {
+			return LogLine{
+				Seq:    seq,
+				Stream: "gosuv",
+				Time:   time.Now(),
+				Text:   fmt.Sprintf("--- %d bytes skipped ---", skipped),
+			}, true
+		}
+		line := *value.(*LogLine)
+		line.Seq = seq
+		if s.stream == "" || s.stream == line.Stream {
+			return line, true
+		}
+	}
+}
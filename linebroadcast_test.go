@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func readLines(sub *LineSubscriber, n int) []LogLine {
+	lines := make([]LogLine, 0, n)
+	for i := 0; i < n; i++ {
+		line, _ := sub.Next()
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestLineBroadcaster(t *testing.T) {
+	Convey("Output should be split into whole lines", t, func() {
+		b := NewLineBroadcaster(1024, 8)
+		defer b.Close()
+		sub := b.Subscribe(0, "")
+		stdout, stderr := b.Writer("stdout"), b.Writer("stderr")
+
+		io.WriteString(stdout, "hel")
+		io.WriteString(stderr, "oops\r\n")
+		io.WriteString(stdout, "lo\nwor")
+		io.WriteString(stdout, "ld\n")
+		lines := readLines(sub, 3)
+		So(lines[0].Text, ShouldEqual, "oops")
+		So(lines[0].Stream, ShouldEqual, "stderr")
+		So(lines[1].Text, ShouldEqual, "hello")
+		So(lines[1].Stream, ShouldEqual, "stdout")
+		So(lines[2].Text, ShouldEqual, "world")
+		So(lines[2].Seq, ShouldEqual, 3)
+		So(lines[2].Time.IsZero(), ShouldBeFalse)
+
+		Convey("Long line should be cut at the max line length", func() {
+			io.WriteString(stdout, "0123456789abc")
+			So(readLines(sub, 1)[0].Text, ShouldEqual, "01234567")
+			b.Flush()
+			So(readLines(sub, 1)[0].Text, ShouldEqual, "89abc")
+		})
+
+		Convey("Subscriber can resume from the sequence number", func() {
+			resumed := b.Subscribe(1, "stdout")
+			So(readLines(resumed, 2)[0].Text, ShouldEqual, "hello")
+			io.WriteString(stderr, "ignored\n")
+			io.WriteString(stdout, "next\n")
+			So(readLines(resumed, 1)[0].Seq, ShouldEqual, 5)
+		})
+
+		Convey("Slow subscriber should get the bytes skipped", func() {
+			for i := 0; i < 200; i++ {
+				io.WriteString(stdout, "0123456\n")
+			}
+			line := readLines(sub, 1)[0]
+			So(line.Stream, ShouldEqual, "gosuv")
+			// 1024 bytes kept, 72 of the 200 lines are overwritten
+			So(line.Text, ShouldEqual, "--- 576 bytes skipped ---")
+			So(b.Stats.Dropped, ShouldEqual, 576)
+			next := readLines(sub, 1)[0]
+			So(next.Seq, ShouldEqual, line.Seq+1)
+			So(next.Text, ShouldEqual, "0123456")
+		})
+	})
+}
+
+func TestRingClose(t *testing.T) {
+	Convey("Put after close should be dropped", t, func() {
+		r := NewRing(1024)
+		So(r.Put("a", 1), ShouldEqual, 1)
+		r.Close()
+		So(func() { r.Put("b", 1) }, ShouldNotPanic)
+		So(r.Seq(), ShouldEqual, 1)
+	})
+}
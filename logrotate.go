@@ -0,0 +1,268 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	rotateTimeFormat = "20060102-150405"
+
+	defaultLogMaxSize    = 50 << 20 // bytes
+	defaultLogMaxBackups = 10
+)
+
+// LogRotate is the rotation policy of program logs,
+// unset values default to 50MB and 10 backups.
+type LogRotate struct {
+	MaxSize    string `yaml:"max_size,omitempty" json:"maxSize"` // eg: 50MB, 0 means no size limit
+	Daily      bool   `yaml:"daily,omitempty" json:"daily"`
+	Compress   bool   `yaml:"compress,omitempty" json:"compress"` // gzip rotated files
+	MaxBackups int    `yaml:"max_backups,omitempty" json:"maxBackups"`
+	MaxAge     int    `yaml:"max_age,omitempty" json:"maxAge"` // days
+}
+
+func (l LogRotate) Check() error {
+	if l.MaxSize == "" {
+		return nil
+	}
+	_, err := parseSize(l.MaxSize)
+	return err
+}
+
+func (l LogRotate) maxSize() int64 {
+	if l.MaxSize == "" {
+		return defaultLogMaxSize
+	}
+	size, _ := parseSize(l.MaxSize)
+	return size
+}
+
+func (l LogRotate) maxBackups() int {
+	if l.MaxBackups == 0 {
+		return defaultLogMaxBackups
+	}
+	return l.MaxBackups
+}
+
+// RotateWriter is a file writer which rotates the file by size or day.
+// Rotated files are renamed to <filename>.<time>[.gz]
+type RotateWriter struct {
+	filename string
+	policy   LogRotate
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	day      string
+}
+
+func NewRotateWriter(filename string, policy LogRotate) (*RotateWriter, error) {
+	w := &RotateWriter{
+		filename: filename,
+		policy:   policy,
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *RotateWriter) open() error {
+	f, err := os.OpenFile(w.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.size = fi.Size()
+	w.day = fi.ModTime().Format("2006-01-02")
+	if w.size == 0 {
+		w.day = time.Now().Format("2006-01-02")
+	}
+	return nil
+}
+
+func (w *RotateWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	if w.needRotate(int64(len(p))) {
+		if err := w.rotate(); err != nil {
+			log.Warnf("rotate %s failed: %v", w.filename, err)
+		}
+	}
+	n, err = w.file.Write(p)
+	w.size += int64(n)
+	return
+}
+
+func (w *RotateWriter) needRotate(add int64) bool {
+	if w.size == 0 {
+		return false
+	}
+	if w.policy.Daily && time.Now().Format("2006-01-02") != w.day {
+		return true
+	}
+	maxSize := w.policy.maxSize()
+	return maxSize > 0 && w.size+add > maxSize
+}
+
+// Rotate the file now
+func (w *RotateWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rotate()
+}
+
+func (w *RotateWriter) rotate() error {
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+	rotated := w.filename + "." + time.Now().Format(rotateTimeFormat)
+	for i := 1; fileExists(rotated) || fileExists(rotated+".gz"); i++ {
+		rotated = fmt.Sprintf("%s.%s-%d", w.filename, time.Now().Format(rotateTimeFormat), i)
+	}
+	if err := os.Rename(w.filename, rotated); err != nil {
+		w.open()
+		return err
+	}
+	go w.cleanup(rotated)
+	return w.open()
+}
+
+// cleanup compresses the rotated file and removes the expired backups
+func (w *RotateWriter) cleanup(rotated string) {
+	if w.policy.Compress {
+		if err := gzipFile(rotated); err != nil {
+			log.Warnf("gzip %s failed: %v", rotated, err)
+		}
+	}
+	backups := rotatedFiles(w.filename)
+	maxBackups, maxAge := w.policy.maxBackups(), w.policy.MaxAge
+	for i, file := range backups {
+		expired := maxBackups > 0 && i >= maxBackups
+		if maxAge > 0 {
+			if fi, err := os.Stat(file); err == nil && time.Since(fi.ModTime()) > time.Duration(maxAge)*24*time.Hour {
+				expired = true
+			}
+		}
+		if expired {
+			log.Infof("remove expired log %s", file)
+			os.Remove(file)
+		}
+	}
+}
+
+// Size returns the size of the current file
+func (w *RotateWriter) Size() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.size
+}
+
+func (w *RotateWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// rotatedFiles returns the rotated files of filename, newest first.
+// Other files with the same prefix like app.log.bak are not included.
+func rotatedFiles(filename string) []string {
+	type rotatedFile struct {
+		name string
+		time time.Time
+		seq  int
+	}
+	matches, _ := filepath.Glob(filename + ".*")
+	rfs := make([]rotatedFile, 0, len(matches))
+	for _, m := range matches {
+		t, seq, ok := parseRotated(strings.TrimPrefix(m, filename+"."))
+		if !ok {
+			continue
+		}
+		rfs = append(rfs, rotatedFile{m, t, seq})
+	}
+	sort.Slice(rfs, func(i, j int) bool {
+		if !rfs[i].time.Equal(rfs[j].time) {
+			return rfs[i].time.After(rfs[j].time)
+		}
+		return rfs[i].seq > rfs[j].seq
+	})
+	files := make([]string, 0, len(rfs))
+	for _, rf := range rfs {
+		files = append(files, rf.name)
+	}
+	return files
+}
+
+// parseRotated parses the suffix of a rotated file: rotate time, optional -N if
+// rotated more than once in a second and optional .gz
+func parseRotated(suffix string) (t time.Time, seq int, ok bool) {
+	suffix = strings.TrimSuffix(suffix, ".gz")
+	if len(suffix) > len(rotateTimeFormat) {
+		rest := suffix[len(rotateTimeFormat):]
+		n, err := strconv.Atoi(rest[1:])
+		if rest[0] != '-' || err != nil || n < 1 {
+			return t, 0, false
+		}
+		seq, suffix = n, suffix[:len(rotateTimeFormat)]
+	}
+	t, err := time.ParseInLocation(rotateTimeFormat, suffix, time.Local)
+	return t, seq, err == nil
+}
+
+func gzipFile(filename string) error {
+	src, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp := filename + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gw := gzip.NewWriter(dst)
+	if _, err = io.Copy(gw, src); err == nil {
+		err = gw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err = os.Rename(tmp, filename+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(filename)
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
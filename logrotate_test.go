@@ -0,0 +1,93 @@
+package main
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRotateWriter(t *testing.T) {
+	Convey("Log should rotate by size and keep max backups", t, func() {
+		dir, err := ioutil.TempDir("", "gosuv")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		filename := filepath.Join(dir, "output.log")
+		w, err := NewRotateWriter(filename, LogRotate{MaxSize: "10B", Compress: true, MaxBackups: 2})
+		So(err, ShouldBeNil)
+		defer w.Close()
+
+		for i := 0; i < 4; i++ {
+			w.Write([]byte("0123456789"))
+			time.Sleep(1100 * time.Millisecond) // rotated file names are in seconds
+		}
+		time.Sleep(100 * time.Millisecond) // wait for compress and cleanup
+		So(w.Size(), ShouldEqual, 10)
+
+		backups := rotatedFiles(filename)
+		So(len(backups), ShouldEqual, 2)
+		So(strings.HasSuffix(backups[0], ".gz"), ShouldBeTrue)
+
+		f, err := os.Open(backups[0])
+		So(err, ShouldBeNil)
+		defer f.Close()
+		gr, err := gzip.NewReader(f)
+		So(err, ShouldBeNil)
+		data, _ := ioutil.ReadAll(gr)
+		So(string(data), ShouldEqual, "0123456789")
+	})
+
+	Convey("Only rotated files should be listed, newest first", t, func() {
+		dir, err := ioutil.TempDir("", "gosuv")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		filename := filepath.Join(dir, "app.log")
+		for _, name := range []string{
+			"app.log.20200101-000000.gz",
+			"app.log.20200102-000000-9",
+			"app.log.20200102-000000-10.gz",
+			"app.log.20200102-000000",
+			"app.log.err",
+			"app.log.bak",
+			"app.log.20200103-000000.gz.tmp",
+			"app.log.20200103-000000-x",
+		} {
+			So(ioutil.WriteFile(filepath.Join(dir, name), nil, 0644), ShouldBeNil)
+		}
+		backups := rotatedFiles(filename)
+		for i := range backups {
+			backups[i] = filepath.Base(backups[i])
+		}
+		So(backups, ShouldResemble, []string{
+			"app.log.20200102-000000-10.gz",
+			"app.log.20200102-000000-9",
+			"app.log.20200102-000000",
+			"app.log.20200101-000000.gz",
+		})
+	})
+
+	Convey("Unset policy should not follow the server log", t, func() {
+		So(LogRotate{}.maxSize(), ShouldEqual, 50<<20)
+		So(LogRotate{}.maxBackups(), ShouldEqual, 10)
+		So(LogRotate{MaxSize: "0"}.maxSize(), ShouldEqual, 0)
+	})
+
+	Convey("Size should be parsed with unit", t, func() {
+		size, err := parseSize("50MB")
+		So(err, ShouldBeNil)
+		So(size, ShouldEqual, 50<<20)
+		size, _ = parseSize("10k")
+		So(size, ShouldEqual, 10<<10)
+		size, _ = parseSize("10000")
+		So(size, ShouldEqual, 10000)
+		_, err = parseSize("ten")
+		So(err, ShouldNotBeNil)
+	})
+}
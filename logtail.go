@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// tailLines returns the last n lines of the log file,
+// continues with the rotated files if the current one is not enough.
+func tailLines(filename string, n int) ([]byte, error) {
+	lines, err := lastLines(filename, n)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, rotated := range rotatedFiles(filename) {
+		if len(lines) >= n {
+			break
+		}
+		more, err := lastLines(rotated, n-len(lines))
+		if err != nil {
+			continue
+		}
+		lines = append(more, lines...)
+	}
+	return bytes.Join(lines, nil), nil
+}
+
+// lastLines reads the last n lines of a file, gzip file is supported
+func lastLines(filename string, n int) ([][]byte, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(filename, ".gz") {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		r = gr
+	} else if fi, err := f.Stat(); err == nil && fi.Size() > 0 {
+		return lastLinesSeek(f, fi.Size(), n)
+	}
+	lines := make([][]byte, 0, n)
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			if len(lines) == n {
+				lines = lines[1:]
+			}
+			lines = append(lines, line)
+		}
+		if err != nil {
+			break
+		}
+	}
+	return lines, nil
+}
+
+// lastLinesSeek reads the file backward, so big files are fast
+func lastLinesSeek(f io.ReaderAt, size int64, n int) ([][]byte, error) {
+	const chunkSize = 4096
+	buf := make([]byte, 0)
+	offset := size
+	for offset > 0 && bytes.Count(bytes.TrimSuffix(buf, []byte("\n")), []byte("\n")) < n {
+		readSize := int64(chunkSize)
+		if offset < readSize {
+			readSize = offset
+		}
+		offset -= readSize
+		chunk := make([]byte, readSize)
+		if _, err := f.ReadAt(chunk, offset); err != nil && err != io.EOF {
+			return nil, err
+		}
+		buf = append(chunk, buf...)
+	}
+	lines := bytes.SplitAfter(buf, []byte("\n"))
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	if offset > 0 && len(lines) > 0 {
+		lines = lines[1:] // maybe not a whole line
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
+
+// readLogFrom returns data of the log file start from offset, and the new offset.
+// If the file is smaller than offset, it has been rotated, read from the beginning.
+func readLogFrom(filename string, offset int64) ([]byte, int64, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, offset, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, offset, err
+	}
+	if offset > fi.Size() || offset < 0 {
+		offset = 0
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, offset, err
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(f, fi.Size()-offset))
+	return data, offset + int64(len(data)), err
+}
+
+// followLog writes new content of the log file to w until the client leaves
+func followLog(w http.ResponseWriter, r *http.Request, filename string, offset int64) {
+	flusher, _ := w.(http.Flusher)
+	var lastInfo os.FileInfo
+	for {
+		fi, err := os.Stat(filename)
+		if err == nil {
+			if lastInfo != nil && !os.SameFile(lastInfo, fi) {
+				offset = 0 // rotated
+			}
+			lastInfo = fi
+			if fi.Size() != offset {
+				var data []byte
+				data, offset, err = readLogFrom(filename, offset)
+				if err == nil && len(data) > 0 {
+					if _, err := w.Write(data); err != nil {
+						return
+					}
+					if flusher != nil {
+						flusher.Flush()
+					}
+				}
+			}
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
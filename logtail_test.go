@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTailLines(t *testing.T) {
+	Convey("Tail should read the current and rotated log files", t, func() {
+		dir, err := ioutil.TempDir("", "gosuv")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		filename := filepath.Join(dir, "output.log")
+		var old, cur strings.Builder
+		for i := 0; i < 1000; i++ {
+			fmt.Fprintf(&old, "old line %d\n", i)
+			fmt.Fprintf(&cur, "current line %d\n", i)
+		}
+		rotated := filename + ".20171204-161500"
+		ioutil.WriteFile(rotated, []byte(old.String()), 0644)
+		So(gzipFile(rotated), ShouldBeNil)
+		ioutil.WriteFile(filename, []byte(cur.String()), 0644)
+
+		data, err := tailLines(filename, 2)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, "current line 998\ncurrent line 999\n")
+
+		data, err = tailLines(filename, 1002)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldStartWith, "old line 998\nold line 999\ncurrent line 0\n")
+
+		Convey("Read from offset", func() {
+			data, offset, err := readLogFrom(filename, int64(cur.Len()-17))
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "current line 999\n")
+			So(offset, ShouldEqual, cur.Len())
+
+			// file rotated, offset is bigger than file size
+			ioutil.WriteFile(filename, []byte("new\n"), 0644)
+			data, offset, _ = readLogFrom(filename, offset)
+			So(string(data), ShouldEqual, "new\n")
+			So(offset, ShouldEqual, 4)
+		})
+	})
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"text/template"
+	"time"
+
+	"gosuv/email"
+	"gosuv/hipchat"
+	"gosuv/pushover"
+	"gosuv/slack"
+	"gosuv/webhook"
+
+	log "github.com/cihub/seelog"
+)
+
+// state changes which can be notified
+const (
+	NotifyFatal     = "fatal"
+	NotifyRestarted = "restarted"
+	NotifyExited    = "exited"
+	NotifyUnhealthy = "unhealthy"
+	NotifyResolved  = "resolved" // sent after an alert when the program is up again
+)
+
+const (
+	DefaultNotifyTitle   = `gosuv: {{.Name}} {{.Event}}`
+	DefaultNotifyMessage = `{{.Name}} changed from {{.From}} to {{.To}} on {{.Hostname}} at {{.Time.Format "2006-01-02 15:04:05"}}` +
+		`{{if .ExitCode}}, exit code {{.ExitCode}}{{end}}{{if .HealthError}}, {{.HealthError}}{{end}}`
+)
+
+// Notification is the data of the title and message templates
+type Notification struct {
+	Name        string    `json:"name"`
+	Event       string    `json:"event"`
+	From        string    `json:"from"`
+	To          string    `json:"to"`
+	Hostname    string    `json:"hostname"`
+	Time        time.Time `json:"time"`
+	ExitCode    int       `json:"exitCode"`
+	HealthError string    `json:"healthError,omitempty"`
+	Title       string    `json:"title"`
+	Message     string    `json:"message"`
+}
+
+// Notifier sends a notification to a channel
+type Notifier interface {
+	Name() string // channel name used in triggers
+	Configured() bool
+	Notify(n Notification) error
+}
+
+type PushoverNotifier struct {
+	ApiKey string   `yaml:"api_key"`
+	Users  []string `yaml:"users"`
+}
+
+func (pn PushoverNotifier) Name() string     { return "pushover" }
+func (pn PushoverNotifier) Configured() bool { return pn.ApiKey != "" && len(pn.Users) > 0 }
+
+func (pn PushoverNotifier) Notify(n Notification) error {
+	for _, user := range pn.Users {
+		err := pushover.Notify(pushover.Params{
+			Token:   pn.ApiKey,
+			User:    user,
+			Title:   n.Title,
+			Message: n.Message,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type HipchatNotifier struct {
+	Token string `yaml:"token"`
+	Room  string `yaml:"room"`
+}
+
+func (hn HipchatNotifier) Name() string     { return "hipchat" }
+func (hn HipchatNotifier) Configured() bool { return hn.Token != "" && hn.Room != "" }
+
+func (hn HipchatNotifier) Notify(n Notification) error {
+	return hipchat.Notify(hipchat.Params{
+		Token:   hn.Token,
+		Room:    hn.Room,
+		Title:   n.Title,
+		Message: n.Message,
+	})
+}
+
+// WebhookNotifier posts the Notification as json
+type WebhookNotifier struct {
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+}
+
+func (wn WebhookNotifier) Name() string     { return "webhook" }
+func (wn WebhookNotifier) Configured() bool { return wn.URL != "" }
+
+func (wn WebhookNotifier) Notify(n Notification) error {
+	return webhook.Notify(webhook.Params{
+		URL:     wn.URL,
+		Headers: wn.Headers,
+		Data:    n,
+	})
+}
+
+type EmailNotifier struct {
+	Host     string   `yaml:"host"`
+	Port     int      `yaml:"port,omitempty"` // default 25
+	Username string   `yaml:"username,omitempty"`
+	Password string   `yaml:"password,omitempty"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+func (en EmailNotifier) Name() string     { return "email" }
+func (en EmailNotifier) Configured() bool { return en.Host != "" && len(en.To) > 0 }
+
+func (en EmailNotifier) Notify(n Notification) error {
+	return email.Notify(email.Params{
+		Host:     en.Host,
+		Port:     en.Port,
+		Username: en.Username,
+		Password: en.Password,
+		From:     en.From,
+		To:       en.To,
+		Title:    n.Title,
+		Message:  n.Message,
+	})
+}
+
+// SlackNotifier works with any Slack compatible incoming webhook
+type SlackNotifier struct {
+	URL     string `yaml:"url"`
+	Channel string `yaml:"channel,omitempty"`
+}
+
+func (sn SlackNotifier) Name() string     { return "slack" }
+func (sn SlackNotifier) Configured() bool { return sn.URL != "" }
+
+func (sn SlackNotifier) Notify(n Notification) error {
+	return slack.Notify(slack.Params{
+		URL:      sn.URL,
+		Channel:  sn.Channel,
+		Username: AppName,
+		Title:    n.Title,
+		Message:  n.Message,
+	})
+}
+
+var notifyEvents = []string{NotifyFatal, NotifyRestarted, NotifyExited, NotifyUnhealthy}
+
+func (ns Notifications) all() []Notifier {
+	return []Notifier{ns.Pushover, ns.Hipchat, ns.Webhook, ns.Email, ns.Slack}
+}
+
+// Notifiers returns the configured channels
+func (ns Notifications) Notifiers() []Notifier {
+	notifiers := make([]Notifier, 0)
+	for _, n := range ns.all() {
+		if n.Configured() {
+			notifiers = append(notifiers, n)
+		}
+	}
+	return notifiers
+}
+
+// NotifiersOf returns the channels to notify of event
+func (ns Notifications) NotifiersOf(event string) []Notifier {
+	if len(ns.Triggers) == 0 {
+		if event == NotifyFatal {
+			return ns.Notifiers()
+		}
+		return nil
+	}
+	notifiers := make([]Notifier, 0)
+	for _, name := range ns.Triggers[event] {
+		for _, n := range ns.Notifiers() {
+			if n.Name() == name {
+				notifiers = append(notifiers, n)
+			}
+		}
+	}
+	return notifiers
+}
+
+func (ns Notifications) Check() error {
+	for event, names := range ns.Triggers {
+		if !containsString(notifyEvents, event) {
+			return fmt.Errorf("notifications: unknown trigger %s, should be one of %v", event, notifyEvents)
+		}
+		for _, name := range names {
+			found := false
+			for _, n := range ns.Notifiers() {
+				found = found || n.Name() == name
+			}
+			if !found {
+				return fmt.Errorf("notifications: channel %s of trigger %s is not configured", name, event)
+			}
+		}
+	}
+	if _, err := parseNotifyTemplate(ns.Title, DefaultNotifyTitle); err != nil {
+		return fmt.Errorf("notifications: title: %v", err)
+	}
+	if _, err := parseNotifyTemplate(ns.Message, DefaultNotifyMessage); err != nil {
+		return fmt.Errorf("notifications: message: %v", err)
+	}
+	return nil
+}
+
+func parseNotifyTemplate(text, defaultText string) (*template.Template, error) {
+	if text == "" {
+		text = defaultText
+	}
+	return template.New("notify").Parse(text)
+}
+
+func renderNotifyTemplate(text, defaultText string, n Notification) (string, error) {
+	tmpl, err := parseNotifyTemplate(text, defaultText)
+	if err != nil {
+		return "", err
+	}
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, n); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Render fills the title and message of n with the templates
+func (ns Notifications) Render(n *Notification) (err error) {
+	if n.Title, err = renderNotifyTemplate(ns.Title, DefaultNotifyTitle, *n); err != nil {
+		return err
+	}
+	n.Message, err = renderNotifyTemplate(ns.Message, DefaultNotifyMessage, *n)
+	return err
+}
+
+// Send notifies the channels triggered by n.Event
+func (ns Notifications) Send(n Notification) {
+	ns.SendTo(n, ns.NotifiersOf(n.Event))
+}
+
+// SendTo renders n and sends it to notifiers
+func (ns Notifications) SendTo(n Notification, notifiers []Notifier) {
+	if len(notifiers) == 0 {
+		return
+	}
+	if err := ns.Render(&n); err != nil {
+		log.Warnf("[%s] notification template error: %v", n.Name, err)
+		return
+	}
+	for _, notifier := range notifiers {
+		if err := notifier.Notify(n); err != nil {
+			log.Warnf("[%s] %s notification error: %v", n.Name, notifier.Name(), err)
+		}
+	}
+}
+
+// notifyEvent returns the notification event of the new state, empty if none.
+// NotifyRestarted is sent by the restarts, see Dispatcher.Restarted
+func notifyEvent(newState FSMState) string {
+	switch newState {
+	case Fatal:
+		return NotifyFatal
+	case Exited:
+		return NotifyExited
+	case Unhealthy:
+		return NotifyUnhealthy
+	}
+	return ""
+}
+
+func (p *Process) notification(event string, oldState, newState FSMState, now time.Time) Notification {
+	hostname, _ := os.Hostname()
+	return Notification{
+		Name:        p.Name,
+		Event:       event,
+		From:        string(oldState),
+		To:          string(newState),
+		Hostname:    hostname,
+		Time:        now,
+		ExitCode:    p.ExitCode,
+		HealthError: p.HealthError,
+	}
+}
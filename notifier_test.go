@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNotifications(t *testing.T) {
+	Convey("Triggers should choose the channels", t, func() {
+		ns := Notifications{}
+		ns.Slack.URL = "http://127.0.0.1/slack"
+		ns.Webhook.URL = "http://127.0.0.1/hook"
+		So(ns.Check(), ShouldBeNil)
+		So(len(ns.Notifiers()), ShouldEqual, 2)
+
+		// only fatal notifies all channels by default
+		So(len(ns.NotifiersOf(NotifyFatal)), ShouldEqual, 2)
+		So(len(ns.NotifiersOf(NotifyExited)), ShouldEqual, 0)
+
+		ns.Triggers = map[string][]string{
+			NotifyRestarted: {"slack"},
+		}
+		So(ns.Check(), ShouldBeNil)
+		So(len(ns.NotifiersOf(NotifyFatal)), ShouldEqual, 0)
+		So(ns.NotifiersOf(NotifyRestarted)[0].Name(), ShouldEqual, "slack")
+
+		ns.Triggers["crashed"] = []string{"slack"}
+		So(ns.Check(), ShouldNotBeNil)
+		delete(ns.Triggers, "crashed")
+		ns.Triggers[NotifyFatal] = []string{"email"}
+		So(ns.Check().Error(), ShouldContainSubstring, "not configured")
+	})
+
+	Convey("Message should be rendered with the templates", t, func() {
+		n := Notification{
+			Name:     "web",
+			Event:    NotifyExited,
+			From:     "running",
+			To:       "exited",
+			Hostname: "box",
+			Time:     time.Date(2017, 12, 4, 16, 15, 0, 0, time.Local),
+			ExitCode: 2,
+		}
+		ns := Notifications{}
+		So(ns.Render(&n), ShouldBeNil)
+		So(n.Title, ShouldEqual, "gosuv: web exited")
+		So(n.Message, ShouldEqual, "web changed from running to exited on box at 2017-12-04 16:15:00, exit code 2")
+
+		ns.Message = "{{.Name}} is {{.To"
+		So(ns.Check(), ShouldNotBeNil)
+		ns.Message = "{{.Name}}: {{.Event}}"
+		So(ns.Render(&n), ShouldBeNil)
+		So(n.Message, ShouldEqual, "web: exited")
+	})
+
+	Convey("Webhook and slack should post json", t, func() {
+		received := make(chan map[string]interface{}, 2)
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var data map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&data)
+			data["path"] = r.URL.Path
+			data["token"] = r.Header.Get("X-Token")
+			received <- data
+		}))
+		defer ts.Close()
+
+		ns := Notifications{}
+		ns.Slack.URL = ts.URL + "/slack"
+		ns.Webhook.URL = ts.URL + "/hook"
+		ns.Webhook.Headers = map[string]string{"X-Token": "abc"}
+		ns.Title = "{{.Name}} {{.Event}}"
+		ns.Message = "code {{.ExitCode}}"
+		ns.Send(Notification{Name: "web", Event: NotifyFatal, ExitCode: 1})
+
+		for i := 0; i < 2; i++ {
+			data := <-received
+			if data["path"] == "/hook" {
+				So(data["token"], ShouldEqual, "abc")
+				So(data["name"], ShouldEqual, "web")
+				So(data["message"], ShouldEqual, "code 1")
+			} else {
+				So(data["text"], ShouldEqual, "*web fatal*\ncode 1")
+			}
+		}
+	})
+
+	Convey("State changes should map to events", t, func() {
+		So(notifyEvent(Fatal), ShouldEqual, NotifyFatal)
+		So(notifyEvent(Running), ShouldEqual, "")
+		So(notifyEvent(Unhealthy), ShouldEqual, NotifyUnhealthy)
+		So(notifyEvent(Exited), ShouldEqual, NotifyExited)
+	})
+}
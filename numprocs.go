@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// %(process_num) or with format like %(process_num)02d, as in supervisord
+var processNumPattern = regexp.MustCompile(`%\(process_num\)(\d*d)?`)
+
+// expandProcessNum replaces %(process_num) in s with num
+func expandProcessNum(s string, num int) string {
+	return processNumPattern.ReplaceAllStringFunc(s, func(m string) string {
+		format := strings.TrimPrefix(m, "%(process_num)")
+		if format == "" {
+			format = "d"
+		}
+		return fmt.Sprintf("%"+format, num)
+	})
+}
+
+// IsTemplate reports whether the program runs as instances named by %(process_num)
+func (p *Program) IsTemplate() bool {
+	return processNumPattern.MatchString(p.Name)
+}
+
+// ProgramName is the name without %(process_num), eg: worker for worker-%(process_num).
+// Programs are identified by it, the instances are identified by the expanded names.
+func (p *Program) ProgramName() string {
+	if !p.IsTemplate() {
+		return p.Name
+	}
+	return strings.Trim(processNumPattern.ReplaceAllString(p.Name, ""), "-_.:@ ")
+}
+
+func (p *Program) numProcs() int {
+	if p.NumProcs < 1 {
+		return 1
+	}
+	return p.NumProcs
+}
+
+// Instances returns the program of every instance, %(process_num) is expanded
+// in name, command, environ, directory, log files and health check.
+func (p *Program) Instances() []Program {
+	if !p.IsTemplate() {
+		return []Program{*p}
+	}
+	pgs := make([]Program, 0, p.numProcs())
+	for i := 0; i < p.numProcs(); i++ {
+		pgs = append(pgs, p.instance(p.NumProcsStart+i))
+	}
+	return pgs
+}
+
+func (p *Program) instanceNames() []string {
+	if !p.IsTemplate() {
+		return []string{p.Name}
+	}
+	names := make([]string, 0, p.numProcs())
+	for i := 0; i < p.numProcs(); i++ {
+		names = append(names, expandProcessNum(p.Name, p.NumProcsStart+i))
+	}
+	return names
+}
+
+func (p *Program) instance(num int) Program {
+	pg := *p
+	pg.Name = expandProcessNum(p.Name, num)
+	pg.Command = expandProcessNum(p.Command, num)
+	pg.Environ = nil
+	for _, env := range p.Environ {
+		pg.Environ = append(pg.Environ, expandProcessNum(env, num))
+	}
+	pg.Dir = expandProcessNum(p.Dir, num)
+	pg.StdoutLogfile = expandProcessNum(p.StdoutLogfile, num)
+	pg.StderrLogfile = expandProcessNum(p.StderrLogfile, num)
+	pg.HealthCheck.HTTP = expandProcessNum(p.HealthCheck.HTTP, num)
+	pg.HealthCheck.TCP = expandProcessNum(p.HealthCheck.TCP, num)
+	pg.HealthCheck.Exec = expandProcessNum(p.HealthCheck.Exec, num)
+	return pg
+}
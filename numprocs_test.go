@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestProgramInstances(t *testing.T) {
+	Convey("%(process_num) should be expanded for every instance", t, func() {
+		So(expandProcessNum("worker-%(process_num)", 3), ShouldEqual, "worker-3")
+		So(expandProcessNum("--port 80%(process_num)02d", 3), ShouldEqual, "--port 8003")
+		So(expandProcessNum("worker", 3), ShouldEqual, "worker")
+
+		pg := Program{
+			Name:          "worker-%(process_num)",
+			Command:       "worker --port 80%(process_num)02d",
+			Environ:       []string{"NUM=%(process_num)"},
+			Dir:           "/tmp/%(process_num)",
+			HealthCheck:   HealthCheck{TCP: "127.0.0.1:80%(process_num)02d"},
+			NumProcs:      2,
+			NumProcsStart: 1,
+		}
+		So(pg.Check(), ShouldBeNil)
+		So(pg.ProgramName(), ShouldEqual, "worker")
+		So(pg.instanceNames(), ShouldResemble, []string{"worker-1", "worker-2"})
+		pgs := pg.Instances()
+		So(len(pgs), ShouldEqual, 2)
+		So(pgs[1].Name, ShouldEqual, "worker-2")
+		So(pgs[1].Command, ShouldEqual, "worker --port 8002")
+		So(pgs[1].Environ, ShouldResemble, []string{"NUM=2"})
+		So(pgs[1].Dir, ShouldEqual, "/tmp/2")
+		So(pgs[1].HealthCheck.TCP, ShouldEqual, "127.0.0.1:8002")
+		So(pg.Environ, ShouldResemble, []string{"NUM=%(process_num)"})
+
+		plain := Program{Name: "redis", Command: "redis-server"}
+		So(plain.ProgramName(), ShouldEqual, "redis")
+		So(plain.instanceNames(), ShouldResemble, []string{"redis"})
+
+		plain.NumProcs = 2
+		So(plain.Check(), ShouldNotBeNil)
+		So((&Program{Name: "%(process_num)", Command: "sleep 1"}).Check(), ShouldNotBeNil)
+	})
+}
+
+func TestScaleProgram(t *testing.T) {
+	Convey("Scale should add and remove instances without restarting the others", t, func() {
+		dir, err := ioutil.TempDir("", "gosuv")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		s := newTestSupervisor(dir)
+		names := func() []string {
+			ns := []string{}
+			for _, p := range s.procs() {
+				ns = append(ns, p.Name)
+			}
+			return ns
+		}
+
+		pg := Program{Name: "worker-%(process_num)", Command: "sleep 30", NumProcs: 2}
+		So(s.addOrUpdateProgram(pg), ShouldBeNil)
+		So(names(), ShouldResemble, []string{"worker-0", "worker-1"})
+		So(s.procMap["worker-1"].Parent, ShouldEqual, "worker")
+		So(s.addOrUpdateProgram(Program{Name: "worker-1", Command: "sleep 1"}), ShouldNotBeNil)
+
+		procs, err := s.selectProcs("worker", "", "")
+		So(err, ShouldBeNil)
+		So(len(procs), ShouldEqual, 2)
+		_, err = s.lookupProcess("worker")
+		So(err.(*APIError).Status, ShouldEqual, 400)
+		So(err.Error(), ShouldContainSubstring, "worker-0, worker-1")
+		proc, err := s.lookupProcess("worker-1")
+		So(err, ShouldBeNil)
+		So(proc, ShouldEqual, s.procMap["worker-1"])
+		s.operate(httptest.NewRequest("POST", "/api/programs/worker-0/start", nil), OpStart, procs[:1], 0)
+		So(s.procMap["worker-0"].State(), ShouldEqual, Running)
+		pid := s.procMap["worker-0"].pid()
+
+		_, err = s.scaleProgram("worker", 3)
+		So(err, ShouldBeNil)
+		So(names(), ShouldResemble, []string{"worker-0", "worker-1", "worker-2"})
+		So(s.procMap["worker-2"].State(), ShouldEqual, Running) // started as worker-0 is running
+		So(s.procMap["worker-1"].State(), ShouldEqual, Stopped)
+		So(s.procMap["worker-0"].pid(), ShouldEqual, pid)
+		pgs, err := readProgramFile(s.programPath())
+		So(err, ShouldBeNil)
+		So(pgs[0].NumProcs, ShouldEqual, 3)
+
+		worker2 := s.procMap["worker-2"]
+		_, err = s.scaleProgram("worker", 1)
+		So(err, ShouldBeNil)
+		So(names(), ShouldResemble, []string{"worker-0"})
+		proc, err = s.lookupProcess("worker")
+		So(err, ShouldBeNil)
+		So(proc.Name, ShouldEqual, "worker-0")
+		for i := 0; i < 50 && worker2.IsRunning(); i++ {
+			time.Sleep(100 * time.Millisecond)
+		}
+		So(worker2.IsRunning(), ShouldBeFalse)
+		So(s.procMap["worker-0"].pid(), ShouldEqual, pid)
+
+		_, err = s.scaleProgram("worker", 0)
+		So(err.(*APIError).Status, ShouldEqual, 400)
+		_, err = s.scaleProgram("nope", 2)
+		So(err.(*APIError).Status, ShouldEqual, 404)
+		_, err = s.lookupProcess("nope")
+		So(err.(*APIError).Status, ShouldEqual, 404)
+
+		s.removeProgram("worker")
+		So(names(), ShouldBeEmpty)
+		So(s.procMap, ShouldBeEmpty)
+	})
+}
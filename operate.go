@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// operations on programs, see Supervisor.operate
+const (
+	OpStart   = "start"
+	OpStop    = "stop"
+	OpRestart = "restart"
+	OpSignal  = "signal"
+)
+
+// OperateResult is the outcome of an operation on one program
+type OperateResult struct {
+	Name  string   `json:"name"`
+	OK    bool     `json:"ok"`
+	State FSMState `json:"state"` // state after the operation is sent
+	Error string   `json:"error,omitempty"`
+}
+
+// filterProcs returns the programs in order which are in the group (if not empty)
+// and match the label selector
+func (s *Supervisor) filterProcs(group, selector string) ([]*Process, error) {
+	sel, err := ParseSelector(selector)
+	if err != nil {
+		return nil, errBadRequest("%v", err)
+	}
+	procs := make([]*Process, 0)
+	for _, proc := range s.procs() {
+		if (group == "" || proc.Group == group) && sel.Matches(proc.Labels) {
+			procs = append(procs, proc)
+		}
+	}
+	return procs, nil
+}
+
+// selectProcs returns the programs in order matched by target, the group and the label selector,
+// target is all, a glob pattern like web-* or a program name (every instance) or instance name
+func (s *Supervisor) selectProcs(target, group, selector string) ([]*Process, error) {
+	procs, err := s.filterProcs(group, selector)
+	if err != nil {
+		return nil, err
+	}
+	isName := target != "all" && !strings.ContainsAny(target, "*?[")
+	if isName {
+		_, isProgram := s.program(target)
+		if _, ok := s.process(target); !ok && !isProgram {
+			return nil, errNotFound("program %s not exists", strconv.Quote(target))
+		}
+	} else if _, err := filepath.Match(target, ""); err != nil {
+		return nil, errBadRequest("invalid pattern %s", target)
+	}
+	selected := make([]*Process, 0, len(procs))
+	for _, proc := range procs {
+		if isName {
+			if proc.Name != target && proc.Parent != target {
+				continue
+			}
+		} else if target != "all" {
+			if ok, _ := filepath.Match(target, proc.Name); !ok {
+				continue
+			}
+		}
+		selected = append(selected, proc)
+	}
+	if len(selected) == 0 {
+		if isName {
+			return nil, errNotFound("program %s not in group or not matches selector", strconv.Quote(target))
+		}
+		return nil, errNotFound("no program matches %s", strconv.Quote(target))
+	}
+	return selected, nil
+}
+
+// operate sends the operation to every program, sig is only for OpSignal
+func (s *Supervisor) operate(r *http.Request, op string, procs []*Process, sig syscall.Signal) []OperateResult {
+	results := make([]OperateResult, 0, len(procs))
+	for _, proc := range procs {
+		action := op
+		if op == OpSignal {
+			action = "signal " + sig.String()
+		}
+		s.recordAction(r, action, proc.Name)
+		var err error
+		switch op {
+		case OpStart:
+			proc.Operate(StartEvent)
+		case OpStop:
+			proc.Operate(StopEvent)
+		case OpRestart:
+			if proc.State() == RetryWait {
+				// start at once instead of waiting for the next retry
+				proc.Operate(StopEvent)
+				for i := 0; i < 20 && proc.State() != Stopped; i++ {
+					time.Sleep(100 * time.Millisecond)
+				}
+				proc.Operate(StartEvent)
+				proc.restarted(RetryWait)
+			} else if isUp(proc.State()) {
+				proc.Operate(RestartEvent) // notifies restarted when up again
+			} else {
+				proc.Operate(StartEvent)
+			}
+		case OpSignal:
+			err = proc.Signal(sig)
+		}
+		result := OperateResult{Name: proc.Name, OK: err == nil, State: proc.State()}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
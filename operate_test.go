@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSelector(t *testing.T) {
+	Convey("Selector should match labels", t, func() {
+		labels := map[string]string{"team": "payments", "tier": "api"}
+		for selector, match := range map[string]bool{
+			"":                         true,
+			"team=payments":            true,
+			"team=payments,tier=api":   true,
+			"team = payments, tier":    true,
+			"team=payments,tier!=api":  false,
+			"team!=search":             true,
+			"canary":                   false,
+			"team=search":              false,
+			"region!=us,team=payments": true,
+		} {
+			sel, err := ParseSelector(selector)
+			So(err, ShouldBeNil)
+			So(sel.Matches(labels), ShouldEqual, match)
+		}
+		_, err := ParseSelector("=payments")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestOperatePrograms(t *testing.T) {
+	Convey("Operations should apply to all, patterns, groups and selectors", t, func() {
+		s := newTestSupervisor("",
+			Program{Name: "web-1", Command: "sleep 30", Group: "web", Labels: map[string]string{"tier": "web"}},
+			Program{Name: "web-2", Command: "sleep 30", Group: "web", Labels: map[string]string{"tier": "web"}},
+			Program{Name: "db", Command: "sleep 30", Labels: map[string]string{"tier": "db"}},
+		)
+		req := httptest.NewRequest("POST", "/api/programs/all/start", nil)
+		names := func(procs []*Process) []string {
+			ns := []string{}
+			for _, p := range procs {
+				ns = append(ns, p.Name)
+			}
+			return ns
+		}
+
+		procs, err := s.selectProcs("all", "", "")
+		So(err, ShouldBeNil)
+		So(names(procs), ShouldResemble, []string{"web-1", "web-2", "db"})
+		procs, _ = s.selectProcs("web-*", "", "")
+		So(names(procs), ShouldResemble, []string{"web-1", "web-2"})
+		procs, _ = s.selectProcs("all", "", "tier=db")
+		So(names(procs), ShouldResemble, []string{"db"})
+		procs, _ = s.selectProcs("db", "", "")
+		So(names(procs), ShouldResemble, []string{"db"})
+		procs, _ = s.selectProcs("all", "web", "")
+		So(names(procs), ShouldResemble, []string{"web-1", "web-2"})
+		procs, _ = s.filterProcs("", "tier=db")
+		So(names(procs), ShouldResemble, []string{"db"})
+		procs, _ = s.filterProcs("cache", "")
+		So(procs, ShouldBeEmpty)
+
+		_, err = s.selectProcs("cache", "", "")
+		So(err.(*APIError).Status, ShouldEqual, 404)
+		_, err = s.selectProcs("web-*", "", "tier=db")
+		So(err.(*APIError).Status, ShouldEqual, 404)
+		_, err = s.selectProcs("db", "web", "")
+		So(err.(*APIError).Status, ShouldEqual, 404)
+		_, err = s.selectProcs("all", "", "=db")
+		So(err.(*APIError).Status, ShouldEqual, 400)
+
+		procs, _ = s.selectProcs("all", "web", "")
+		results := s.operate(req, OpStart, procs, 0)
+		So(len(results), ShouldEqual, 2)
+		So(results[0].OK, ShouldBeTrue)
+		So(results[0].State, ShouldEqual, Running)
+		So(s.procMap["db"].State(), ShouldEqual, Stopped)
+
+		results = s.operate(req, OpSignal, s.procs(), syscall.SIGCONT)
+		So(results[0].OK, ShouldBeTrue)
+		So(results[2].OK, ShouldBeFalse)
+		So(results[2].Error, ShouldContainSubstring, "not running")
+
+		waitAll := func(ok func(p *Process) bool) {
+			for i := 0; i < 50; i++ {
+				done := true
+				for _, p := range s.procs() {
+					done = done && ok(p)
+				}
+				if done {
+					return
+				}
+				time.Sleep(100 * time.Millisecond)
+			}
+		}
+		pids := map[string]int{"web-1": s.procMap["web-1"].pid(), "web-2": s.procMap["web-2"].pid()}
+		results = s.operate(req, OpRestart, s.procs(), 0)
+		So(results[2].State, ShouldEqual, Running)
+		// restart is stop then start in background
+		waitAll(func(p *Process) bool { return p.State() == Running && p.pid() != pids[p.Name] })
+		So(s.procMap["web-1"].pid(), ShouldNotEqual, pids["web-1"])
+		So(s.procMap["web-2"].pid(), ShouldNotEqual, pids["web-2"])
+
+		s.operate(req, OpStop, s.procs(), 0)
+		waitAll(func(p *Process) bool { return p.State() == Stopped })
+		for _, p := range s.procs() {
+			So(p.State(), ShouldEqual, Stopped)
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -9,65 +10,146 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	log "github.com/cihub/seelog"
 	"github.com/codeskyblue/kexec"
-	"github.com/kennygrant/sanitize"
 )
 
 type Process struct {
-	*FSM       `json:"-"`
-	Program    `json:"program"`
-	cmd        *kexec.KCommand
-	Stdout     *QuickLossBroadcastWriter `json:"-"`
-	Stderr     *QuickLossBroadcastWriter `json:"-"`
-	Output     *QuickLossBroadcastWriter `json:"-"`
-	OutputFile *os.File                  `json:"-"`
-	stopC      chan syscall.Signal
-	retryLeft  int
-	Status     string `json:"status"`
+	*FSM           `json:"-"`
+	Program        `json:"program"`
+	Parent         string `json:"parent"` // program of the instance, see Program.Instances
+	cmd            *kexec.KCommand
+	Output         *LineBroadcaster `json:"-"` // stdout and stderr lines
+	OutputStats    *RingStats       `json:"outputStats"`
+	OutputFile     *RotateWriter    `json:"-"` // stdout log
+	StderrFile     *RotateWriter    `json:"-"` // nil if redirect_stderr
+	stopC          chan syscall.Signal
+	RetryLeft      int        `json:"retryLeft"`
+	RetryDelay     float64    `json:"retryDelay"` // seconds to wait before next retry
+	NextRetry      *time.Time `json:"nextRetry,omitempty"`
+	Status         string     `json:"status"`
+	Pid            int        `json:"pid"` // pid of the current or the last run
+	ExitCode       int        `json:"exitCode"`
+	ExitSignal     string     `json:"exitSignal,omitempty"`
+	ExitTime       *time.Time `json:"exitTime,omitempty"`
+	NextRun        *time.Time `json:"nextRun,omitempty"` // only for scheduled program
+	HealthFailures int        `json:"healthFailures"`
+	HealthError    string     `json:"healthError,omitempty"`
 
+	runStart time.Time
+	reason   string // reason of the next state change, see stateReason
+	stale    bool   // still runs the old definition, see Supervisor.rollingRestart
+
+	onRestart func(from FSMState) // called with mu held, see restarted
+
+	// only for eventlistener
+	eventSource *WriteBroadcaster
+	eventSeq    uint64 // seq of the last event accepted by the listener
+	poolSerial  int
+	listenerIn  io.WriteCloser
+	listenerOut io.ReadCloser
+
+	// guards cmd, Pid and the retry, exit, run, schedule and health fields,
+	// and is held on every state change so StateChange callbacks can read them
 	mu sync.Mutex
 }
 
+// MarshalJSON encodes a snapshot of the process taken under p.mu
+func (p *Process) MarshalJSON() ([]byte, error) {
+	type plainProcess Process // without MarshalJSON
+	p.mu.Lock()
+	snapshot := &plainProcess{
+		Program:        p.Program,
+		Parent:         p.Parent,
+		RetryLeft:      p.RetryLeft,
+		RetryDelay:     p.RetryDelay,
+		NextRetry:      p.NextRetry,
+		Status:         p.Status,
+		Pid:            p.Pid,
+		ExitCode:       p.ExitCode,
+		ExitSignal:     p.ExitSignal,
+		ExitTime:       p.ExitTime,
+		NextRun:        p.NextRun,
+		HealthFailures: p.HealthFailures,
+		HealthError:    p.HealthError,
+	}
+	p.mu.Unlock()
+	if p.OutputStats != nil {
+		snapshot.OutputStats = &RingStats{
+			Written: atomic.LoadInt64(&p.OutputStats.Written),
+			Dropped: atomic.LoadInt64(&p.OutputStats.Dropped),
+		}
+	}
+	return json.Marshal(snapshot)
+}
+
+// pid returns the pid of the current or the last run
+func (p *Process) pid() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.Pid
+}
+
 // FIXME(ssx): maybe need to return error
 func (p *Process) buildCommand() *kexec.KCommand {
 	cmd := kexec.CommandString(p.Command)
-	logDir := filepath.Join(Cfg.Server.Log.LogPath, sanitize.Name(p.Name))
+	logDir := p.logDir()
 	if !IsDir(logDir) {
 		os.MkdirAll(logDir, 0755)
 	}
 
-	var err error
-	var foutOut, foutErr io.Writer
+	var foutOut, foutErr io.Writer = ioutil.Discard, ioutil.Discard
 
-	outFile := filepath.Join(logDir, "output.log")
+	// left by the last run which quit by itself
+	p.closeLogFiles()
 
 	if p.LogDisable {
 		log.Infof("disabled stdout and stderr log")
-		foutOut = ioutil.Discard
-		foutErr = ioutil.Discard
 	} else {
-		p.OutputFile, err = os.OpenFile(outFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		var err error
+		p.OutputFile, err = p.openLogFile(p.StdoutLogPath(), p.LogRotate)
 		if err != nil {
 			log.Warnf("[%s] create stdout log failed: %+v", p.Name, err)
-			foutOut = ioutil.Discard
-			foutErr = ioutil.Discard
 		} else {
 			if p.StderrOnly {
 				log.Infof("[%s] disabled stdout log", p.Name)
-				foutOut = ioutil.Discard
 			} else {
 				foutOut = p.OutputFile
 			}
-			foutErr = p.OutputFile
+		}
+		if p.StderrLogPath() == p.StdoutLogPath() {
+			if p.OutputFile != nil {
+				foutErr = p.OutputFile
+			}
+		} else if p.StderrFile, err = p.openLogFile(p.StderrLogPath(), p.stderrLogRotate()); err != nil {
+			log.Warnf("[%s] create stderr log failed: %+v", p.Name, err)
+		} else {
+			foutErr = p.StderrFile
 		}
 	}
 
-	cmd.Stdout = io.MultiWriter(p.Stdout, p.Output, foutOut)
-	cmd.Stderr = io.MultiWriter(p.Stderr, p.Output, foutErr)
+	if p.IsEventListener() {
+		// stdin and stdout are used by the event listener protocol
+		var err error
+		if p.listenerIn, err = cmd.StdinPipe(); err != nil {
+			log.Warnf("[%s] create stdin pipe failed: %v", p.Name, err)
+		}
+		if p.listenerOut, err = cmd.StdoutPipe(); err != nil {
+			log.Warnf("[%s] create stdout pipe failed: %v", p.Name, err)
+		}
+	} else {
+		cmd.Stdout = io.MultiWriter(p.Output.Writer("stdout"), foutOut)
+	}
+	if p.RedirectStderr && !p.IsEventListener() {
+		// share the pipe of stdout to keep the order of the output
+		cmd.Stderr = cmd.Stdout
+	} else {
+		cmd.Stderr = io.MultiWriter(p.Output.Writer("stderr"), foutErr)
+	}
 
 	cmd.Env = os.Environ()
 	environ := map[string]string{}
@@ -106,108 +188,279 @@ func (p *Process) buildCommand() *kexec.KCommand {
 	return cmd
 }
 
+func (p *Process) openLogFile(filename string, policy LogRotate) (*RotateWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return nil, err
+	}
+	return NewRotateWriter(filename, policy)
+}
+
+func (p *Process) closeLogFiles() {
+	p.Output.Flush()
+	if p.OutputFile != nil {
+		p.OutputFile.Close()
+		p.OutputFile = nil
+	}
+	if p.StderrFile != nil {
+		p.StderrFile.Close()
+		p.StderrFile = nil
+	}
+}
+
 func (p *Process) waitNextRetry() {
 	p.mu.Lock()
-	defer p.mu.Unlock()
-	p.SetState(RetryWait)
-	if p.retryLeft <= 0 {
-		p.retryLeft = p.StartRetries
+	if p.RetryLeft <= 0 {
+		p.RetryLeft = p.StartRetries
+		p.clearRetryDelay()
 		p.SetState(Fatal)
+		p.mu.Unlock()
 		return
 	}
-	p.retryLeft -= 1
+	p.RetryLeft -= 1
+	retryLeft := p.RetryLeft
+	delay := p.Backoff.Duration(p.StartRetries - retryLeft)
+	nextRetry := time.Now().Add(delay)
+	p.RetryDelay = delay.Seconds()
+	p.NextRetry = &nextRetry
+	p.SetState(RetryWait)
+	p.mu.Unlock()
+
 	select {
-	case <-time.After(2 * time.Second): // TODO: need put it into Program
-		log.Warnf("[%s] retry start program,left times: %+v", p.Name, p.retryLeft)
+	case <-time.After(delay):
+		log.Warnf("[%s] retry start program after %v, left times: %+v", p.Name, delay, retryLeft)
+		p.mu.Lock()
+		p.clearRetryDelay()
+		p.mu.Unlock()
 		p.startCommand()
+		p.restarted(RetryWait)
 	case <-p.stopC:
-		log.Infof("[%s] try to  stop command", p.Name)
-		p.stopCommand()
+		log.Infof("[%s] stop waiting retry", p.Name)
+		p.mu.Lock()
+		p.clearRetryDelay()
+		p.mu.Unlock()
+		// the command has exited and been waited, nothing to signal
+		p.exited(Stopped)
 	}
+}
 
+// restarted tells onRestart the program is up again after a restart,
+// from is the state before the restart
+func (p *Process) restarted(from FSMState) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.onRestart != nil && isUp(p.State()) {
+		p.onRestart(from)
+	}
+}
+
+// clearRetryDelay resets the retry wait. Caller should hold p.mu
+func (p *Process) clearRetryDelay() {
+	p.RetryDelay = 0
+	p.NextRetry = nil
 }
 
 func (p *Process) resetRetry() {
-	timer := time.NewTimer(time.Minute * 1)
+	uptime := p.HealthyUptime
+	if uptime <= 0 {
+		uptime = defaultHealthyUptime
+	}
+	timer := time.NewTimer(time.Duration(uptime) * time.Second)
 	<-timer.C
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	if p.State() == Running && p.retryLeft < p.StartRetries {
-		log.Tracef("[%s] reset retry from %+v to %+v", p.Name, p.retryLeft, p.StartRetries)
-		p.retryLeft = p.StartRetries
+	if isUp(p.State()) && p.RetryLeft < p.StartRetries {
+		log.Tracef("[%s] reset retry from %+v to %+v", p.Name, p.RetryLeft, p.StartRetries)
+		p.RetryLeft = p.StartRetries
 	}
 }
 
 func (p *Process) stopCommand() {
 
 	p.mu.Lock()
-	defer p.mu.Unlock()
-	defer p.SetState(Stopped)
-
-	if p.cmd == nil {
+	cmd := p.cmd
+	if cmd == nil {
 		log.Infof("[%s] not found command", p.Name)
+		p.SetState(Stopped)
+		p.mu.Unlock()
 		return
 	}
-
 	p.SetState(Stopping)
+	// not held while waiting the command, the process can be listed meanwhile
+	p.mu.Unlock()
 
-	if p.cmd.Process != nil {
-		p.cmd.Process.Signal(syscall.SIGTERM)
+	waitC := GoFunc(cmd.Wait)
+	var err error
+	quit := false
+	for _, step := range p.stopSteps() {
+		sig, _ := parseSignal(step.Signal)
+		if cmd.Process != nil {
+			log.Infof("[%s] send signal %v, wait %ds", p.Name, sig, step.Wait)
+			cmd.Process.Signal(sig)
+		}
+		select {
+		case err = <-waitC:
+			quit = true
+		case <-time.After(time.Duration(step.Wait) * time.Second):
+		}
+		if quit {
+			log.Infof("[%s] program quit normally", p.Name)
+			break
+		}
 	}
-
-	select {
-	case <-GoFunc(p.cmd.Wait):
-		log.Infof("[%s] program quit normally", p.Name)
-	case <-time.After(time.Duration(p.StopTimeout) * time.Second):
+	if !quit {
 		log.Infof("[%s] program terminate all", p.Name)
-		p.cmd.Terminate(syscall.SIGKILL)
+		cmd.Terminate(syscall.SIGKILL)
+		err = <-waitC
 	}
 
-	err := p.cmd.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.setExitStatus()
 
 	prefixStr := "\n--- GOSUV LOG " + time.Now().Format("2006-01-02 15:04:05")
 	if err == nil {
-		io.WriteString(p.cmd.Stderr, fmt.Sprintf("%s exit success ---\n\n", prefixStr))
+		io.WriteString(cmd.Stderr, fmt.Sprintf("%s exit success ---\n\n", prefixStr))
 	} else {
-		io.WriteString(p.cmd.Stderr, fmt.Sprintf("%s exit fail %v ---\n\n", prefixStr, err))
+		io.WriteString(cmd.Stderr, fmt.Sprintf("%s exit fail %v ---\n\n", prefixStr, err))
 	}
-	if p.OutputFile != nil {
-		p.OutputFile.Close()
-		p.OutputFile = nil
+	p.closeLogFiles()
+	p.cmd = nil
+	p.SetState(Stopped)
+}
+
+// recordExit saves the exit status of the finished command,
+// and returns if the program need restart
+func (p *Process) recordExit() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.setExitStatus()
+	return p.ShouldRestart(p.ExitCode, p.ExitSignal != "")
+}
+
+// setExitStatus saves exit code, signal and the run history. Caller should hold p.mu
+func (p *Process) setExitStatus() {
+	now := time.Now()
+	p.ExitTime = &now
+	p.ExitCode = -1
+	p.ExitSignal = ""
+	if p.cmd != nil && p.cmd.ProcessState != nil {
+		if ws, ok := p.cmd.ProcessState.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			p.ExitSignal = ws.Signal().String()
+		} else {
+			p.ExitCode = p.cmd.ProcessState.ExitCode()
+		}
+	} // else status lost, maybe reaped by watchChildSignal
+
+	if p.runStart.IsZero() {
+		return
 	}
+	p.saveRun(Run{
+		StartTime:  p.runStart,
+		Duration:   now.Sub(p.runStart).Seconds(),
+		ExitCode:   p.ExitCode,
+		ExitSignal: p.ExitSignal,
+	})
+	p.runStart = time.Time{}
+}
+
+// exited closes the log file of the quitted command and set to the state
+func (p *Process) exited(state FSMState) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cmd != nil {
+		prefixStr := "\n--- GOSUV LOG " + time.Now().Format("2006-01-02 15:04:05")
+		io.WriteString(p.cmd.Stderr, fmt.Sprintf("%s exit with code %d ---\n\n", prefixStr, p.ExitCode))
+	}
+	p.closeLogFiles()
 	p.cmd = nil
+	p.SetState(state)
+}
+
+// IsReady reports whether dependents can start: healthy if health check defined,
+// else running longer than start_seconds, or a oneshot job exited successfully
+func (p *Process) IsReady() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch p.State() {
+	case Running:
+		if p.HealthCheck.Enabled() {
+			return false
+		}
+		return !p.runStart.IsZero() && time.Since(p.runStart) >= time.Duration(p.StartSeconds)*time.Second
+	case Healthy:
+		return true
+	case Exited:
+		return p.IsJob()
+	}
+	return false
 }
 
 func (p *Process) IsRunning() bool {
-	return p.State() == Running || p.State() == RetryWait
+	return isUp(p.State()) || p.State() == RetryWait
 }
 
 func (p *Process) startCommand() {
 
 	log.Infof("[%s] start cmd: %s", p.Name, p.Command)
-	p.cmd = p.buildCommand()
+	p.mu.Lock()
+	cmd := p.buildCommand()
+	p.cmd = cmd
 
-	p.SetState(Running)
-	log.Tracef("[%s] state is %v", p.Name, p.Status)
-	if err := p.cmd.Start(); err != nil {
+	if err := cmd.Start(); err != nil {
 		log.Warnf("[%s] program start failed: %v", p.Name, err)
+		p.reason = "start failed: " + err.Error()
 		p.SetState(Fatal)
+		p.mu.Unlock()
 		return
 	}
+	p.Pid = cmd.Process.Pid
+	p.runStart = time.Now()
+	p.SetState(Running)
+	p.HealthFailures = 0
+	p.HealthError = ""
+	p.mu.Unlock()
+	log.Tracef("[%s] state is %v", p.Name, Running)
 
 	//重置retry次数
 	go p.resetRetry()
 
+	done := make(chan struct{})
+	if p.HealthCheck.Enabled() {
+		go p.watchHealth(done)
+	}
+	if p.IsEventListener() && p.eventSource != nil {
+		go p.serveEvents(p.listenerIn, p.listenerOut, done)
+	}
+
 	go func() {
-		errC := GoFunc(p.cmd.Wait)
+		defer close(done)
+		errC := GoFunc(cmd.Wait)
 		startTime := time.Now()
 		select {
 		case <-errC:
 			// if p.cmd.Wait() returns, it means program and its sub process all quited. no need to kill again
 			// func Wait() will only return when program session finish.
 			log.Warnf("[%s] program finished, time used %v", p.Name, time.Since(startTime))
+			restart := p.recordExit()
+			if p.IsJob() {
+				if p.ExitSignal == "" && p.IsExpectedExit(p.ExitCode) {
+					p.exited(Exited)
+				} else {
+					log.Warnf("[%s] job failed, exit code %d %s", p.Name, p.ExitCode, p.ExitSignal)
+					p.exited(Fatal)
+				}
+				return
+			}
+			if !restart {
+				log.Infof("[%s] program exit with expected code %d, not restart", p.Name, p.ExitCode)
+				p.exited(Exited)
+				return
+			}
 			if time.Since(startTime) < time.Duration(p.StartSeconds)*time.Second {
-				if p.retryLeft == p.StartRetries { // If first time quit so fast, just set to fatal
+				p.mu.Lock()
+				firstQuit := p.RetryLeft == p.StartRetries
+				p.mu.Unlock()
+				if firstQuit { // If first time quit so fast, just set to fatal
 					log.Infof("[%s] program exit too quick, sleep 100ms", p.Name)
 					time.Sleep(time.Microsecond * 100)
 				}
@@ -221,23 +474,20 @@ func (p *Process) startCommand() {
 }
 
 func NewProcess(pg Program) *Process {
-	outputBufferSize := 24 * 1024 // 24K
+	outputBufferSize := 256 * 1024 // 256K
+	maxLineLength := 16 * 1024     // 16K
 	pr := &Process{
 		FSM:       NewFSM(Stopped),
 		Program:   pg,
+		Parent:    pg.Name,
 		stopC:     make(chan syscall.Signal),
-		retryLeft: pg.StartRetries,
+		RetryLeft: pg.StartRetries,
 		Status:    string(Stopped),
-		Output:    NewQuickLossBroadcastWriter(outputBufferSize),
-		Stdout:    NewQuickLossBroadcastWriter(outputBufferSize),
-		Stderr:    NewQuickLossBroadcastWriter(outputBufferSize),
+		Output:    NewLineBroadcaster(outputBufferSize, maxLineLength),
 	}
+	pr.OutputStats = pr.Output.Stats
 	pr.StateChange = func(_, newStatus FSMState) {
 		pr.Status = string(newStatus)
-		// TODO: status need to filter with config, not hard coded.
-		if newStatus == Fatal {
-			go pr.Program.RunNotification()
-		}
 	}
 	if pr.StartSeconds <= 0 {
 		pr.StartSeconds = 2
@@ -246,24 +496,36 @@ func NewProcess(pg Program) *Process {
 		pr.StopTimeout = 3
 	}
 
-		pr.AddHandler(Stopped, StartEvent, func() {
-		pr.retryLeft = pr.StartRetries
+	startWithRetries := func() {
+		pr.mu.Lock()
+		pr.RetryLeft = pr.StartRetries
+		pr.mu.Unlock()
 		pr.startCommand()
-	})
+	}
+	pr.AddHandler(Stopped, StartEvent, startWithRetries)
 	pr.AddHandler(Fatal, StartEvent, pr.startCommand)
+	pr.AddHandler(Exited, StartEvent, startWithRetries)
 
-	pr.AddHandler(Running, StopEvent, func() {
+	sendStop := func() {
 		select {
 		case pr.stopC <- syscall.SIGTERM:
 		case <-time.After(200 * time.Millisecond):
 		}
-	}).AddHandler(Running, RestartEvent, func() {
+	}
+	pr.AddHandler(RetryWait, StopEvent, sendStop)
+	restart := func() {
+		from := pr.State()
 		go func() {
 			pr.Operate(StopEvent)
-			// TODO: start laterly ?
-			time.Sleep(1 * time.Second)
+			for pr.IsRunning() || pr.State() == Stopping {
+				time.Sleep(100 * time.Millisecond)
+			}
 			pr.Operate(StartEvent)
+			pr.restarted(from)
 		}()
-	})
+	}
+	for _, state := range []FSMState{Running, Healthy, Unhealthy} {
+		pr.AddHandler(state, StopEvent, sendStop).AddHandler(state, RestartEvent, restart)
+	}
 	return pr
 }
@@ -4,10 +4,18 @@ import (
 	"errors"
 	"fmt"
 	"os/user"
+	"path/filepath"
 
-	"gosuv/pushover"
+	"gosuv/cron"
 
-	log "github.com/cihub/seelog"
+	"github.com/kennygrant/sanitize"
+)
+
+const (
+	ProgramDaemon  = "daemon"
+	ProgramOneshot = "oneshot"
+	// reads events from stdin with the supervisord event listener protocol
+	ProgramEventListener = "eventlistener"
 )
 
 func (p *Program) Check() error {
@@ -17,24 +25,141 @@ func (p *Program) Check() error {
 	if p.Command == "" {
 		return errors.New("Program command empty")
 	}
+	if p.NumProcs < 0 || p.NumProcsStart < 0 || p.RollingBatch < 0 {
+		return errors.New("numprocs, numprocs_start and rolling_batch should not be negative")
+	}
+	if p.NumProcs > 1 && !p.IsTemplate() {
+		return errors.New("name should contain %(process_num) when numprocs > 1")
+	}
+	if p.ProgramName() == "" {
+		return errors.New("Program name empty without %(process_num)")
+	}
+	if err := p.Backoff.Check(); err != nil {
+		return err
+	}
+	if p.StopSignal != "" {
+		if _, err := parseSignal(p.StopSignal); err != nil {
+			return err
+		}
+	}
+	for _, step := range p.StopSequence {
+		if _, err := parseSignal(step.Signal); err != nil {
+			return err
+		}
+	}
+	if err := p.HealthCheck.Check(); err != nil {
+		return err
+	}
+	if err := p.LogRotate.Check(); err != nil {
+		return err
+	}
+	if err := p.StderrLogRotate.Check(); err != nil {
+		return err
+	}
+	if err := p.Notifications.Check(); err != nil {
+		return err
+	}
+	if err := p.WebHook.Check(); err != nil {
+		return err
+	}
+	switch p.Type {
+	case "", ProgramDaemon, ProgramOneshot, ProgramEventListener:
+	default:
+		return fmt.Errorf("unknown program type: %s", p.Type)
+	}
+	for _, event := range p.Events {
+		if !knownListenerEvent(event) {
+			return fmt.Errorf("unknown event %s, should be EVENT, PROCESS_STATE or PROCESS_STATE_<STATE>", event)
+		}
+	}
+	if p.Schedule != "" {
+		if _, err := cron.Parse(p.Schedule); err != nil {
+			return err
+		}
+	}
+	switch p.AutoRestart {
+	case "", AutoRestartAlways, AutoRestartNever, AutoRestartUnexpected:
+	default:
+		return fmt.Errorf("autorestart should be true, false or unexpected, got %s", p.AutoRestart)
+	}
 	return nil
 }
 
-func (p *Program) RunNotification() {
-	po := p.Notifications.Pushover
-	if po.ApiKey != "" && len(po.Users) > 0 {
-		for _, user := range po.Users {
-			err := pushover.Notify(pushover.Params{
-				Token:   po.ApiKey,
-				User:    user,
-				Title:   "gosuv",
-				Message: fmt.Sprintf("%s change to fatal", p.Name),
-			})
-			if err != nil {
-				log.Warnf("pushover error: %v", err)
-			}
+// IsJob reports whether the program runs to finish instead of being kept alive
+func (p *Program) IsJob() bool {
+	return p.Type == ProgramOneshot || p.Schedule != ""
+}
+
+func (p *Program) IsEventListener() bool {
+	return p.Type == ProgramEventListener
+}
+
+func (p *Program) logDir() string {
+	return filepath.Join(Cfg.Server.Log.LogPath, sanitize.Name(p.Name))
+}
+
+// StdoutLogPath returns the stdout log file, relative path is based on the log dir of program
+func (p *Program) StdoutLogPath() string {
+	return p.logPath(p.StdoutLogfile, "output.log")
+}
+
+// StderrLogPath returns the stderr log file, it is the stdout log file if redirect_stderr
+func (p *Program) StderrLogPath() string {
+	if p.RedirectStderr {
+		return p.StdoutLogPath()
+	}
+	return p.logPath(p.StderrLogfile, "stderr.log")
+}
+
+func (p *Program) logPath(file, defaultName string) string {
+	if file == "" {
+		file = defaultName
+	}
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(p.logDir(), file)
+}
+
+func (p *Program) stderrLogRotate() LogRotate {
+	if p.StderrLogRotate == (LogRotate{}) {
+		return p.LogRotate
+	}
+	return p.StderrLogRotate
+}
+
+type AutoRestart string
+
+const (
+	AutoRestartAlways     AutoRestart = "true"
+	AutoRestartNever      AutoRestart = "false"
+	AutoRestartUnexpected AutoRestart = "unexpected"
+)
+
+// IsExpectedExit reports whether code is one of exitcodes
+func (p *Program) IsExpectedExit(code int) bool {
+	codes := p.ExitCodes
+	if len(codes) == 0 {
+		codes = []int{0}
+	}
+	for _, c := range codes {
+		if c == code {
+			return true
 		}
 	}
+	return false
+}
+
+// ShouldRestart decides if a program which quit by itself need restart.
+// A program killed by signal always counts as unexpected.
+func (p *Program) ShouldRestart(code int, signaled bool) bool {
+	switch p.AutoRestart {
+	case AutoRestartAlways:
+		return true
+	case AutoRestartNever:
+		return false
+	}
+	return signaled || !p.IsExpectedExit(code)
 }
 
 func IsRoot() bool {
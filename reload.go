@@ -0,0 +1,98 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+)
+
+// ProgramChange describes a program whose definition changed on disk.
+type ProgramChange struct {
+	Name   string   `json:"name"`
+	Fields []string `json:"fields"`
+}
+
+// ReloadPlan is what a reload did, or would do with dry run.
+type ReloadPlan struct {
+	DryRun    bool            `json:"dryRun"`
+	Added     []string        `json:"added"`
+	Removed   []string        `json:"removed"`
+	Restarted []ProgramChange `json:"restarted"`
+	Updated   []ProgramChange `json:"updated"` // only labels, group, numprocs or rolling_batch changed, not restarted
+	Unchanged []string        `json:"unchanged"`
+}
+
+// diffPrograms compares the running programs (in names order) with the
+// ones read from disk.
+func diffPrograms(names []string, pgMap map[string]Program, pgs []Program) ReloadPlan {
+	plan := ReloadPlan{
+		Added:     []string{},
+		Removed:   []string{},
+		Restarted: []ProgramChange{},
+		Updated:   []ProgramChange{},
+		Unchanged: []string{},
+	}
+	visited := map[string]bool{}
+	for _, pg := range pgs {
+		name := pg.ProgramName()
+		visited[name] = true
+		orig, ok := pgMap[name]
+		if !ok {
+			plan.Added = append(plan.Added, name)
+			continue
+		}
+		if fields := changedFields(orig, pg); needRestart(fields) {
+			plan.Restarted = append(plan.Restarted, ProgramChange{Name: name, Fields: fields})
+		} else if len(fields) > 0 {
+			plan.Updated = append(plan.Updated, ProgramChange{Name: name, Fields: fields})
+		} else {
+			plan.Unchanged = append(plan.Unchanged, name)
+		}
+	}
+	for _, name := range names {
+		if !visited[name] {
+			plan.Removed = append(plan.Removed, name)
+		}
+	}
+	return plan
+}
+
+// changedFields returns the yaml names of the Program fields which differ
+func changedFields(a, b Program) []string {
+	fields := []string{}
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	t := va.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) || bothEmpty(va.Field(i), vb.Field(i)) {
+			continue
+		}
+		name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if name == "" {
+			name = t.Field(i).Name
+		}
+		fields = append(fields, name)
+	}
+	return fields
+}
+
+// bothEmpty reports whether a and b are nil or empty slices or maps,
+// programs saved by saveDB have environ: [] instead of nil
+func bothEmpty(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Slice, reflect.Map:
+		return a.Len() == 0 && b.Len() == 0
+	}
+	return false
+}
+
+// inPlaceFields can be changed without restarting the program,
+// numprocs only adds or removes instances, see Supervisor.scaleInstances
+var inPlaceFields = map[string]bool{"labels": true, "group": true, "numprocs": true, "rolling_batch": true}
+
+func needRestart(fields []string) bool {
+	for _, name := range fields {
+		if !inPlaceFields[name] {
+			return true
+		}
+	}
+	return false
+}
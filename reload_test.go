@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDiffPrograms(t *testing.T) {
+	Convey("Reload plan should classify every program", t, func() {
+		pgMap := map[string]Program{
+			"keep":   {Name: "keep", Command: "sleep 1", Environ: []string{}},
+			"change": {Name: "change", Command: "sleep 1"},
+			"gone":   {Name: "gone", Command: "sleep 1"},
+			"label":  {Name: "label", Command: "sleep 1"},
+		}
+		names := []string{"keep", "change", "gone", "label"}
+		pgs := []Program{
+			{Name: "keep", Command: "sleep 1"},
+			{Name: "change", Command: "sleep 2", Dir: "/tmp"},
+			{Name: "new", Command: "sleep 1"},
+			{Name: "label", Command: "sleep 1", Group: "web", Labels: map[string]string{"tier": "web"}},
+		}
+		plan := diffPrograms(names, pgMap, pgs)
+		So(plan.Added, ShouldResemble, []string{"new"})
+		So(plan.Removed, ShouldResemble, []string{"gone"})
+		So(plan.Unchanged, ShouldResemble, []string{"keep"})
+		So(plan.Restarted, ShouldResemble, []ProgramChange{
+			{Name: "change", Fields: []string{"command", "directory"}},
+		})
+		So(plan.Updated, ShouldResemble, []ProgramChange{
+			{Name: "label", Fields: []string{"labels", "group"}},
+		})
+	})
+}
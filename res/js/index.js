@@ -15,6 +15,8 @@ var vm = new Vue({
   data: {
     isConnectionAlive: true,
     log: {
+      name: '',
+      stream: '',
       content: '',
       follow: true,
       line_count: 0,
@@ -24,6 +26,30 @@ var vm = new Vue({
       program: null,
     }
   },
+  computed: {
+    // programs without group first, then every group in order
+    groups: function() {
+      var groups = [{
+        name: "",
+        programs: []
+      }];
+      var index = {
+        "": 0
+      };
+      this.programs.forEach(function(p) {
+        var name = p.program.group || "";
+        if (index[name] === undefined) {
+          index[name] = groups.length;
+          groups.push({
+            name: name,
+            programs: []
+          });
+        }
+        groups[index[name]].programs.push(p);
+      });
+      return groups;
+    }
+  },
   methods: {
     addNewProgram: function() {
       console.log("Add")
@@ -116,12 +142,25 @@ var vm = new Vue({
         }
       })
     },
+    cmdGroup: function(group, op) {
+      $.ajax({
+        url: "/api/programs/all/" + op,
+        method: 'post',
+        data: {
+          group: group
+        },
+        success: function(data) {
+          console.log(data);
+        }
+      })
+    },
     cmdTail: function(name) {
       var that = this;
       if (W.wsLog) {
         W.wsLog.close()
       }
-      W.wsLog = newWebsocket("/ws/logs/" + name, {
+      this.log.name = name;
+      W.wsLog = newWebsocket("/ws/logs/" + name + "?stream=" + this.log.stream, {
         onopen: function(evt) {
           that.log.content = "";
           that.log.line_count = 0;
@@ -162,6 +201,8 @@ var vm = new Vue({
     canStop: function(status) {
       switch (status) {
         case "running":
+        case "healthy":
+        case "unhealthy":
         case "retry wait":
           return true;
       }
@@ -173,6 +214,11 @@ Vue.filter('fromNow', function(value) {
   return moment(value).fromNow();
 })
 
+Vue.filter('retryIn', function(value) {
+  var seconds = Math.max(0, Math.ceil((new Date(value) - new Date()) / 1000));
+  return seconds + "s";
+})
+
 Vue.filter('formatBytes', function(value) {
   var bytes = parseFloat(value);
   if (bytes < 0) return "-";
@@ -190,9 +236,14 @@ Vue.filter('colorStatus', function(value) {
     case "stopping":
       return makeColorText(value, "#996633");
     case "running":
+    case "healthy":
       return makeColorText(value, "green");
+    case "unhealthy":
+      return makeColorText(value, "orange");
     case "fatal":
       return makeColorText(value, "red");
+    case "exited":
+      return makeColorText(value, "#337ab7");
     default:
       return makeColorText(value, "gray");
   }
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+// readyTimeout is how long to wait the instance to be ready, by rolling restart and
+// the programs depending on it
+func readyTimeout(p *Process) time.Duration {
+	timeout := time.Duration(p.StartSeconds)*time.Second + 30*time.Second
+	if p.HealthCheck.Enabled() {
+		timeout += p.HealthCheck.interval()*time.Duration(p.HealthCheck.threshold()) + p.HealthCheck.timeout()
+	}
+	return timeout
+}
+
+// waitReady waits the process to be running longer than start_seconds, or healthy
+// if health check is defined. Returns error if it fails to come back.
+func waitReady(p *Process, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for !p.IsReady() {
+		switch state := p.State(); state {
+		case Fatal, Exited, Stopped, RetryWait, Unhealthy:
+			return fmt.Errorf("%s is %s", p.Name, state)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s is not ready in %v", p.Name, timeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return nil
+}
+
+// rollingRestart restarts procs batch at a time, the next batch is restarted after every
+// instance of the batch is ready. It aborts when an instance fails to come back, the rest
+// are left as they are.
+//
+// With replace (definition changed) every instance is replaced with a process of the
+// current definition and only the running ones are started. If aborted the rest are
+// marked stale, they are replaced by the next rolling restart.
+func (s *Supervisor) rollingRestart(procs []*Process, batch int, replace bool) ([]OperateResult, error) {
+	s.rollingMu.Lock()
+	defer s.rollingMu.Unlock()
+	if batch < 1 {
+		batch = 1
+	}
+	results := make([]OperateResult, 0, len(procs))
+	var abortErr error
+	for i := 0; i < len(procs); i += batch {
+		end := i + batch
+		if end > len(procs) {
+			end = len(procs)
+		}
+		chunk := make([]*Process, 0, batch)
+		for _, p := range procs[i:end] {
+			// the process may be replaced by the rolling restart before, or removed by scale
+			if p, ok := s.process(p.Name); ok {
+				chunk = append(chunk, p)
+			}
+		}
+		if abortErr != nil {
+			for _, p := range chunk {
+				p.stale = p.stale || replace
+				results = append(results, OperateResult{Name: p.Name, State: p.State(), Error: "not restarted, rolling restart aborted"})
+			}
+			continue
+		}
+
+		wasRunning := make([]bool, len(chunk))
+		fromStates := make([]FSMState, len(chunk))
+		var wg sync.WaitGroup
+		for j, p := range chunk {
+			fromStates[j] = p.State()
+			wasRunning[j] = p.IsRunning()
+			wg.Add(1)
+			go func(p *Process) {
+				defer wg.Done()
+				s.stopProcess(p)
+			}(p)
+		}
+		wg.Wait()
+
+		started := make([]*Process, len(chunk))
+		for j, p := range chunk {
+			if replace || p.stale {
+				p = s.replaceInstance(p)
+			}
+			if wasRunning[j] || !replace {
+				p.Operate(StartEvent)
+				started[j] = p
+			}
+			if wasRunning[j] {
+				p.restarted(fromStates[j])
+			}
+		}
+		errs := make([]error, len(chunk))
+		for j, p := range started {
+			if p == nil {
+				continue
+			}
+			wg.Add(1)
+			go func(j int, p *Process) {
+				defer wg.Done()
+				errs[j] = waitReady(p, readyTimeout(p))
+			}(j, p)
+		}
+		wg.Wait()
+
+		for j, p := range chunk {
+			if started[j] != nil {
+				p = started[j]
+			}
+			result := OperateResult{Name: p.Name, OK: errs[j] == nil, State: p.State()}
+			if errs[j] != nil {
+				result.Error = errs[j].Error()
+				if abortErr == nil {
+					abortErr = fmt.Errorf("rolling restart aborted: %v", errs[j])
+				}
+			}
+			results = append(results, result)
+		}
+	}
+	return results, abortErr
+}
+
+// replaceInstance replaces the stopped p with a new process of the current definition
+func (s *Supervisor) replaceInstance(p *Process) *Process {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pg := s.pgMap[p.Parent]
+	for _, inst := range pg.Instances() {
+		if inst.Name != p.Name {
+			continue
+		}
+		np := s.newProcess(inst)
+		np.Parent = p.Parent
+		s.procMap[np.Name] = np
+		return np
+	}
+	return p
+}
+
+// operateRolling is the rolling restart of restart --rolling
+func (s *Supervisor) operateRolling(r *http.Request, procs []*Process, batch int) []OperateResult {
+	for _, proc := range procs {
+		s.recordAction(r, "rolling restart", proc.Name)
+	}
+	results, err := s.rollingRestart(procs, batch, false)
+	if err != nil {
+		log.Warnf("%v", err)
+	}
+	return results
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRollingRestart(t *testing.T) {
+	Convey("Rolling restart should restart batch at a time and abort on failure", t, func() {
+		dir, err := ioutil.TempDir("", "gosuv")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		s := newTestSupervisor(dir)
+		req := httptest.NewRequest("POST", "/api/programs/worker/restart", nil)
+		// instance fails to start if file fail-<num> exists
+		failFile := filepath.Join(dir, "fail-")
+		pg := Program{
+			Name:         "worker-%(process_num)",
+			Command:      "test -f " + failFile + "%(process_num) && exit 1; sleep 30",
+			NumProcs:     3,
+			StartSeconds: 1,
+		}
+		So(s.addOrUpdateProgram(pg), ShouldBeNil)
+		defer s.removeProgram("worker")
+		procs := s.programProcs("worker")
+		s.operate(req, OpStart, procs, 0)
+		pids := func() []int {
+			ps := []int{}
+			for _, p := range s.programProcs("worker") {
+				ps = append(ps, p.pid())
+			}
+			return ps
+		}
+		before := pids()
+
+		start := time.Now()
+		results := s.operateRolling(req, procs, 2)
+		So(len(results), ShouldEqual, 3)
+		for _, result := range results {
+			So(result.OK, ShouldBeTrue)
+			So(result.State, ShouldEqual, Running)
+		}
+		So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 2*time.Second) // two batches
+		after := pids()
+		for i := range before {
+			So(after[i], ShouldNotEqual, before[i])
+		}
+
+		So(ioutil.WriteFile(failFile+"1", nil, 0644), ShouldBeNil)
+		results, err = s.rollingRestart(procs, 1, false)
+		So(err, ShouldNotBeNil)
+		So(results[0].OK, ShouldBeTrue)
+		So(results[1].OK, ShouldBeFalse)
+		So(results[2].OK, ShouldBeFalse)
+		So(results[2].Error, ShouldContainSubstring, "aborted")
+		So(s.procMap["worker-2"].pid(), ShouldEqual, after[2]) // not restarted
+		So(os.Remove(failFile+"1"), ShouldBeNil)
+		s.operate(req, OpStart, s.programProcs("worker")[1:2], 0)
+	})
+
+	Convey("Definition change should replace instances one by one", t, func() {
+		dir, err := ioutil.TempDir("", "gosuv")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		s := newTestSupervisor(dir)
+		req := httptest.NewRequest("POST", "/api/programs/worker/restart", nil)
+		failFile := filepath.Join(dir, "fail-")
+		pg := Program{
+			Name:         "worker-%(process_num)",
+			Command:      "sleep 30",
+			NumProcs:     3,
+			StartSeconds: 1,
+		}
+		So(s.addOrUpdateProgram(pg), ShouldBeNil)
+		defer s.removeProgram("worker")
+		s.operate(req, OpStart, s.programProcs("worker"), 0)
+		// instances are replaced by the rolling restart in background
+		proc := func(name string) *Process {
+			p, _ := s.process(name)
+			return p
+		}
+		oldPid := proc("worker-2").pid()
+		waitFor := func(ok func() bool) {
+			for i := 0; i < 100 && !ok(); i++ {
+				time.Sleep(100 * time.Millisecond)
+			}
+		}
+		cursor := s.newEventCursor()
+		defer cursor.Close()
+		events := cursor.Chan()
+		waitError := func() {
+			timeout := time.After(10 * time.Second)
+			for {
+				select {
+				case v := <-events:
+					if e, ok := v.(Event); ok && e.Type == EventError {
+						return
+					}
+				case <-timeout:
+					return
+				}
+			}
+		}
+
+		// worker-1 fails with the new definition, worker-2 keeps the old one
+		So(ioutil.WriteFile(failFile+"1", nil, 0644), ShouldBeNil)
+		pg.Command = "test -f " + failFile + "%(process_num) && exit 1; sleep 31"
+		So(s.addOrUpdateProgram(pg), ShouldBeNil)
+		waitError()
+		So(proc("worker-2").stale, ShouldBeTrue)
+		So(proc("worker-2").pid(), ShouldEqual, oldPid)
+		So(proc("worker-2").Command, ShouldEqual, "sleep 30")
+		So(proc("worker-0").Command, ShouldContainSubstring, "sleep 31")
+		So(proc("worker-0").State(), ShouldEqual, Running)
+
+		So(os.Remove(failFile+"1"), ShouldBeNil)
+		results := s.operateRolling(req, s.programProcs("worker"), 1)
+		for _, result := range results {
+			So(result.OK, ShouldBeTrue)
+		}
+		So(proc("worker-2").Command, ShouldContainSubstring, "sleep 31")
+		So(proc("worker-2").stale, ShouldBeFalse)
+
+		// scaled down, the kept instances are still replaced one by one
+		pg.NumProcs = 2
+		pg.Command = "sleep 32"
+		So(s.addOrUpdateProgram(pg), ShouldBeNil)
+		So(proc("worker-2"), ShouldBeNil)
+		time.Sleep(300 * time.Millisecond)
+		So(proc("worker-1").Command, ShouldContainSubstring, "sleep 31")
+		So(proc("worker-1").State(), ShouldEqual, Running)
+		waitFor(func() bool { return proc("worker-1").Command == "sleep 32" && proc("worker-1").IsReady() })
+		So(proc("worker-0").Command, ShouldEqual, "sleep 32")
+		So(proc("worker-1").IsReady(), ShouldBeTrue)
+	})
+}
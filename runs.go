@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	runsFileName = "runs.log"
+	maxRuns      = 100
+)
+
+// Run is one execution of a program, finished runs are appended to
+// <logpath>/<name>/runs.log as json lines, the latest maxRuns runs are kept.
+type Run struct {
+	StartTime  time.Time `json:"startTime"`
+	Duration   float64   `json:"duration"` // seconds
+	ExitCode   int       `json:"exitCode"`
+	ExitSignal string    `json:"exitSignal,omitempty"`
+	Running    bool      `json:"running,omitempty"`
+}
+
+func (p *Process) runsFile() string {
+	return filepath.Join(p.logDir(), runsFileName)
+}
+
+func (p *Process) saveRun(r Run) {
+	f, err := os.OpenFile(p.runsFile(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		log.Warnf("[%s] save run history failed: %v", p.Name, err)
+		return
+	}
+	json.NewEncoder(f).Encode(r)
+	f.Close()
+	if err := keepLastLines(p.runsFile(), maxRuns); err != nil {
+		log.Warnf("[%s] remove old run history failed: %v", p.Name, err)
+	}
+}
+
+// keepLastLines removes the lines of file before the last n lines
+func keepLastLines(filename string, n int) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	// the last one is empty as the file ends with a newline
+	if len(lines) <= n+1 {
+		return nil
+	}
+	tmpFile := filename + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, bytes.Join(lines[len(lines)-n-1:], nil), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, filename)
+}
+
+// Runs returns the latest runs, newest first. The current run is included if running.
+func (p *Process) Runs(limit int) ([]Run, error) {
+	runs := make([]Run, 0)
+	f, err := os.Open(p.runsFile())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var r Run
+			if json.Unmarshal(scanner.Bytes(), &r) != nil {
+				continue
+			}
+			runs = append(runs, r)
+		}
+	}
+	p.mu.Lock()
+	if p.cmd != nil && !p.runStart.IsZero() {
+		runs = append(runs, Run{
+			StartTime: p.runStart,
+			Duration:  time.Since(p.runStart).Seconds(),
+			Running:   true,
+		})
+	}
+	p.mu.Unlock()
+
+	for i, j := 0, len(runs)-1; i < j; i, j = i+1, j-1 {
+		runs[i], runs[j] = runs[j], runs[i]
+	}
+	if limit > 0 && len(runs) > limit {
+		runs = runs[:limit]
+	}
+	return runs, nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRuns(t *testing.T) {
+	Convey("Run history should keep the latest runs", t, func() {
+		p := NewProcess(Program{Name: "runs"})
+		So(os.MkdirAll(p.logDir(), 0755), ShouldBeNil)
+		defer os.RemoveAll(p.logDir())
+
+		for i := 0; i < maxRuns+5; i++ {
+			p.saveRun(Run{ExitCode: i})
+		}
+		runs, err := p.Runs(0)
+		So(err, ShouldBeNil)
+		So(len(runs), ShouldEqual, maxRuns)
+		So(runs[0].ExitCode, ShouldEqual, maxRuns+4)
+		So(runs[maxRuns-1].ExitCode, ShouldEqual, 5)
+	})
+}
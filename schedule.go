@@ -0,0 +1,61 @@
+package main
+
+import (
+	"time"
+
+	"gosuv/cron"
+
+	log "github.com/cihub/seelog"
+)
+
+// runScheduler starts the scheduled programs at every matched minute
+func (s *Supervisor) runScheduler() {
+	for _, proc := range s.procs() {
+		proc.scheduleNext(time.Now())
+	}
+	for {
+		now := time.Now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+		time.Sleep(next.Sub(now))
+		s.runScheduledPrograms(next)
+	}
+}
+
+func (s *Supervisor) runScheduledPrograms(t time.Time) {
+	for _, proc := range s.procs() {
+		if proc.Schedule == "" {
+			continue
+		}
+		sched, err := cron.Parse(proc.Schedule)
+		if err != nil {
+			log.Warnf("[%s] %v", proc.Name, err)
+			continue
+		}
+		proc.scheduleNext(t)
+		if !sched.Match(t) {
+			continue
+		}
+		if proc.IsRunning() || proc.State() == Stopping {
+			log.Warnf("[%s] last run not finished, skip scheduled run", proc.Name)
+			continue
+		}
+		log.Infof("[%s] scheduled run", proc.Name)
+		proc.Operate(StartEvent)
+	}
+}
+
+// scheduleNext updates NextRun to the first schedule time after t
+func (p *Process) scheduleNext(t time.Time) {
+	if p.Schedule == "" {
+		return
+	}
+	sched, err := cron.Parse(p.Schedule)
+	if err != nil {
+		return
+	}
+	if next, err := sched.Next(t); err == nil {
+		p.mu.Lock()
+		p.NextRun = &next
+		p.mu.Unlock()
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -22,7 +23,6 @@ import (
 
 	log "github.com/cihub/seelog"
 
-	"github.com/codeskyblue/kexec"
 	"github.com/go-yaml/yaml"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
@@ -38,21 +38,41 @@ func init() {
 type Supervisor struct {
 	ConfigDir string
 
-	names   []string // order of programs
-	pgMap   map[string]Program
-	procMap map[string]*Process
-	mu      sync.Mutex
+	names   []string            // order of programs
+	pgMap   map[string]Program  // program name -> program, see Program.ProgramName
+	pgFiles map[string]string   // program name -> file it belongs to
+	files   []string            // all program files, see Configuration.ProgramFiles
+	procMap map[string]*Process // instance name -> process, see Program.Instances
+	mu      sync.RWMutex        // guards the programs and processes above
+	dbMu    sync.Mutex          // one loadDB or saveDB at a time
 	eventB  *WriteBroadcaster
+
+	silences   *SilenceStore
+	dispatcher *Dispatcher
+	eventStore *EventStore
+
+	deploys  map[string]*deployQueue // program name -> running and queued deploys
+	deployMu sync.Mutex
+
+	rollingMu sync.Mutex // one rolling restart at a time
 }
 
 func newSupervisorHandler() (suv *Supervisor, hdlr http.Handler, err error) {
 	suv = &Supervisor{
 		ConfigDir: CfgDir,
 		pgMap:     make(map[string]Program, 0),
+		pgFiles:   make(map[string]string, 0),
 		procMap:   make(map[string]*Process, 0),
-		eventB:    NewWriteBroadcaster(4 * 1024),
+		eventB:    NewWriteBroadcaster(64 * 1024),
+	}
+	if suv.silences, err = NewSilenceStore(filepath.Join(suv.ConfigDir, DefaultSilenceFile)); err != nil {
+		return
+	}
+	suv.dispatcher = NewDispatcher(Cfg.Server.Notify, suv.silences)
+	if suv.eventStore, err = NewEventStore(filepath.Join(Cfg.Server.Log.LogPath, eventsFileName), Cfg.Server.Events); err != nil {
+		return
 	}
-	if err = suv.loadDB(); err != nil {
+	if _, err = suv.loadDB(false); err != nil {
 		return
 	}
 	suv.catchExitSignal()
@@ -70,8 +90,22 @@ func newSupervisorHandler() (suv *Supervisor, hdlr http.Handler, err error) {
 	r.HandleFunc("/api/programs/{name}", suv.hDelProgram).Methods("DELETE")
 	r.HandleFunc("/api/programs/{name}", suv.hUpdateProgram).Methods("PUT")
 	r.HandleFunc("/api/programs", suv.hAddProgram).Methods("POST")
-	r.HandleFunc("/api/programs/{name}/start", suv.hStartProgram).Methods("POST")
-	r.HandleFunc("/api/programs/{name}/stop", suv.hStopProgram).Methods("POST")
+	r.HandleFunc("/api/programs/{name}/start", suv.hOperatePrograms(OpStart)).Methods("POST")
+	r.HandleFunc("/api/programs/{name}/stop", suv.hOperatePrograms(OpStop)).Methods("POST")
+	r.HandleFunc("/api/programs/{name}/restart", suv.hOperatePrograms(OpRestart)).Methods("POST")
+	r.HandleFunc("/api/programs/{name}/signal", suv.hOperatePrograms(OpSignal)).Methods("POST")
+	r.HandleFunc("/api/programs/{name}/scale", suv.hScaleProgram).Methods("PUT")
+	r.HandleFunc("/api/programs/{name}/runs", suv.hGetProgramRuns).Methods("GET")
+	r.HandleFunc("/api/programs/{name}/log", suv.hGetProgramLog).Methods("GET")
+	r.HandleFunc("/api/programs/{name}/deploys", suv.hGetProgramDeploys).Methods("GET")
+	r.HandleFunc("/api/programs/{name}/deploys/{id}/log", suv.hGetDeployLog).Methods("GET")
+
+	r.HandleFunc("/api/events", suv.hGetEvents).Methods("GET")
+	r.HandleFunc("/api/events/stream", suv.hEventStream).Methods("GET")
+
+	r.HandleFunc("/api/silences", suv.hGetSilences).Methods("GET")
+	r.HandleFunc("/api/silences", suv.hAddSilence).Methods("POST")
+	r.HandleFunc("/api/silences/{id}", suv.hDelSilence).Methods("DELETE")
 
 	r.HandleFunc("/ws/events", suv.wsEvents)
 	r.HandleFunc("/ws/logs/{name}", suv.wsLog)
@@ -79,19 +113,102 @@ func newSupervisorHandler() (suv *Supervisor, hdlr http.Handler, err error) {
 
 	r.HandleFunc("/webhooks/{name}/{category}", suv.hWebhook).Methods("POST")
 
+	suv.handleAPIv2(r)
+
 	return suv, r, nil
 }
 
+// AutoStartPrograms starts programs in dependency order, every program waits until
+// its dependencies are ready. Programs of different dependency chains start in parallel,
+// so a dependency which never comes up only blocks its dependents.
 func (s *Supervisor) AutoStartPrograms() {
-	for _, proc := range s.procMap {
-		if proc.Program.StartAuto {
-			log.Infof("[%s] auto start", proc.Name)
-			proc.Operate(StartEvent)
+	pgs := s.programs()
+	// closed after the start of the program is done or skipped
+	done := make(map[string]chan struct{}, len(pgs))
+	if _, err := startOrder(pgs); err != nil {
+		log.Warnf("sort programs: %v", err)
+	} else {
+		for _, pg := range pgs {
+			done[pg.ProgramName()] = make(chan struct{})
 		}
 	}
+	var wg sync.WaitGroup
+	for _, pg := range pgs {
+		wg.Add(1)
+		go func(pg Program) {
+			defer wg.Done()
+			if c, ok := done[pg.ProgramName()]; ok {
+				defer close(c)
+			}
+			for _, dep := range pg.DependsOn {
+				if c, ok := done[dep]; ok {
+					<-c
+				}
+			}
+			for _, proc := range s.programProcs(pg.ProgramName()) {
+				// scheduled programs are started by runScheduler
+				if !proc.Program.StartAuto || proc.Schedule != "" {
+					continue
+				}
+				if err := s.waitDependencies(proc); err != nil {
+					log.Warnf("[%s] not auto start: %v", proc.Name, err)
+					continue
+				}
+				log.Infof("[%s] auto start", proc.Name)
+				proc.Operate(StartEvent)
+			}
+		}(pg)
+	}
+	wg.Wait()
+}
+
+// program returns the program by the program name
+func (s *Supervisor) program(name string) (Program, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	pg, ok := s.pgMap[name]
+	return pg, ok
+}
+
+// process returns the process by the instance name
+func (s *Supervisor) process(name string) (*Process, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.procMap[name]
+	return p, ok
+}
+
+// lookupProcess returns the process by the instance name, or of a program with
+// only one instance. A program with several instances is rejected with their names.
+func (s *Supervisor) lookupProcess(name string) (*Process, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if p, ok := s.procMap[name]; ok {
+		return p, nil
+	}
+	procs := s.programProcsLocked(name)
+	switch len(procs) {
+	case 0:
+		return nil, errNotFound("program %s not exists", strconv.Quote(name))
+	case 1:
+		return procs[0], nil
+	}
+	names := make([]string, 0, len(procs))
+	for _, p := range procs {
+		names = append(names, p.Name)
+	}
+	return nil, errBadRequest("program %s has instances %s, use an instance name",
+		strconv.Quote(name), strings.Join(names, ", "))
 }
 
 func (s *Supervisor) programs() []Program {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.programsLocked()
+}
+
+// programsLocked is programs, the caller holds s.mu
+func (s *Supervisor) programsLocked() []Program {
 	pgs := make([]Program, 0, len(s.names))
 	for _, name := range s.names {
 		pgs = append(pgs, s.pgMap[name])
@@ -100,9 +217,33 @@ func (s *Supervisor) programs() []Program {
 }
 
 func (s *Supervisor) procs() []*Process {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	ps := make([]*Process, 0, len(s.names))
 	for _, name := range s.names {
-		ps = append(ps, s.procMap[name])
+		ps = append(ps, s.programProcsLocked(name)...)
+	}
+	return ps
+}
+
+// programProcs returns the processes of every instance of the program
+func (s *Supervisor) programProcs(name string) []*Process {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.programProcsLocked(name)
+}
+
+// programProcsLocked is programProcs, the caller holds s.mu
+func (s *Supervisor) programProcsLocked(name string) []*Process {
+	pg, ok := s.pgMap[name]
+	if !ok {
+		return nil
+	}
+	ps := make([]*Process, 0, pg.numProcs())
+	for _, instName := range pg.instanceNames() {
+		if p, ok := s.procMap[instName]; ok { // missing while the program is being updated
+			ps = append(ps, p)
+		}
 	}
 	return ps
 }
@@ -113,50 +254,93 @@ func (s *Supervisor) programPath() string {
 
 func (s *Supervisor) newProcess(pg Program) *Process {
 	p := NewProcess(pg)
+	p.scheduleNext(time.Now())
+	if p.IsEventListener() {
+		p.eventSource = s.eventB
+		p.eventSeq = s.eventB.Seq()
+	}
 	origFunc := p.StateChange
 	p.StateChange = func(oldState, newState FSMState) {
-		s.broadcastEvent(fmt.Sprintf("[%s] state: %s -> %s", p.Name, string(oldState), string(newState)))
+		s.broadcastEvent(p.stateEvent(oldState, newState))
 		origFunc(oldState, newState)
+		if s.dispatcher != nil {
+			s.dispatcher.StateChanged(p, oldState, newState)
+		}
+	}
+	p.onRestart = func(from FSMState) {
+		if s.dispatcher != nil {
+			s.dispatcher.Restarted(p, from)
+		}
 	}
 
-	log.Tracef("new process: %+v", p)
+	log.Tracef("new process: %+v", pg)
 	return p
 }
 
-func (s *Supervisor) broadcastEvent(event string) {
-	s.eventB.Write([]byte(event))
+// broadcastEvent sends the event to the listeners and saves it to the event history
+func (s *Supervisor) broadcastEvent(event Event) {
+	event.Seq = s.eventB.Put(event, len(event.String()))
+	if s.eventStore != nil {
+		if err := s.eventStore.Append(event); err != nil {
+			log.Warnf("save event failed: %v", err)
+		}
+	}
 }
 
-func (s *Supervisor) addStatusChangeListener(c chan string) {
-	sChan := s.eventB.NewChanString(fmt.Sprintf("%d", time.Now().UnixNano()))
-	go func() {
-		for msg := range sChan {
-			c <- msg
-		}
-	}()
+// recordAction saves the admin action of the request to the event history
+func (s *Supervisor) recordAction(r *http.Request, action, program string) {
+	source := r.RemoteAddr
+	if source == "" || source == "@" {
+		source = "unix" // requests from the unix socket have no remote address
+	}
+	if user, _, ok := r.BasicAuth(); ok && user != "" {
+		source = user + "@" + source
+	}
+	s.broadcastEvent(Event{
+		Type:    EventAction,
+		Program: program,
+		Action:  action,
+		Source:  source,
+		Time:    time.Now(),
+	})
+}
+
+// newEventCursor returns a cursor reading the events from now on
+func (s *Supervisor) newEventCursor() *Cursor {
+	return s.eventB.NewCursor(s.eventB.Seq())
 }
 
 // Send Stop signal and wait program stops
 func (s *Supervisor) stopAndWait(name string) error {
-	p, ok := s.procMap[name]
+	p, ok := s.process(name)
 	if !ok {
 		return errors.New("no such program")
 	}
-	if !p.IsRunning() {
-		return nil
+	s.stopProcess(p)
+	return nil
+}
+
+// stopProcess sends Stop signal and waits the process stops
+func (s *Supervisor) stopProcess(p *Process) {
+	if !p.IsRunning() && p.State() != Stopping {
+		return
 	}
-	c := make(chan string, 0)
-	s.addStatusChangeListener(c)
+	stopped := func() bool {
+		return !p.IsRunning() && p.State() != Stopping
+	}
+	cursor := s.newEventCursor()
+	defer cursor.Close()
+	events := cursor.Chan()
 	p.Operate(StopEvent)
 	for {
 		select {
-		case <-c:
-			if !p.IsRunning() {
-				return nil
+		case <-events:
+			if stopped() {
+				return
 			}
 		case <-time.After(1 * time.Second): // In case some event not catched
-			if !p.IsRunning() {
-				return nil
+			if stopped() {
+				return
 			}
 		}
 	}
@@ -164,97 +348,325 @@ func (s *Supervisor) stopAndWait(name string) error {
 
 // 添加或者更新program
 func (s *Supervisor) addOrUpdateProgram(pg Program) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addOrUpdateProgramLocked(pg)
+}
+
+// addOrUpdateProgramLocked is addOrUpdateProgram, the caller holds s.mu
+func (s *Supervisor) addOrUpdateProgramLocked(pg Program) error {
 	// defer s.broadcastEvent(pg.Name + " add or update")
 	if err := pg.Check(); err != nil {
 		return err
 	}
-	origPg, ok := s.pgMap[pg.Name]
+	name := pg.ProgramName()
+	for _, instName := range pg.instanceNames() {
+		if p, ok := s.procMap[instName]; ok && p.Parent != name {
+			return fmt.Errorf("process name %s conflicts with program %s", instName, p.Parent)
+		}
+	}
+	origPg, ok := s.pgMap[name]
 	if ok {
-		if reflect.DeepEqual(origPg, pg) {
+		fields := changedFields(origPg, pg)
+		if len(fields) == 0 {
+			return nil
+		}
+		s.broadcastEvent(programEvent(EventUpdated, name))
+		log.Info("update:", name)
+		origProcs := s.programProcsLocked(name)
+		if !needRestart(fields) {
+			for _, proc := range origProcs {
+				proc.Labels, proc.Group, proc.NumProcs, proc.RollingBatch = pg.Labels, pg.Group, pg.NumProcs, pg.RollingBatch
+			}
+			s.scaleInstancesLocked(name, pg)
 			return nil
 		}
-		s.broadcastEvent(pg.Name + " update")
-		log.Info("update:", pg.Name)
-		origProc := s.procMap[pg.Name]
-		isRunning := origProc.IsRunning()
+		// added instances start with the new definition, the kept ones are replaced
+		// by rolling restart so the program keeps running
+		s.scaleInstancesLocked(name, pg)
+		keep := make(map[string]bool)
+		for _, instName := range pg.instanceNames() {
+			keep[instName] = true
+		}
+		kept := make([]*Process, 0, len(origProcs))
+		for _, proc := range origProcs {
+			if keep[proc.Name] {
+				kept = append(kept, proc)
+			}
+		}
 		go func() {
-			s.stopAndWait(origProc.Name)
-			newProc := s.newProcess(pg)
-			s.procMap[pg.Name] = newProc
-			s.pgMap[pg.Name] = pg
-			if isRunning {
-				newProc.Operate(StartEvent)
+			if _, err := s.rollingRestart(kept, pg.RollingBatch, true); err != nil {
+				log.Warnf("[%s] %v", name, err)
+				event := programEvent(EventError, name)
+				event.Reason = err.Error()
+				s.broadcastEvent(event)
 			}
-			s.saveDB()
 		}()
 	} else {
-		s.names = append(s.names, pg.Name)
-		s.pgMap[pg.Name] = pg
-		s.procMap[pg.Name] = s.newProcess(pg)
-		s.broadcastEvent(pg.Name + " added")
+		s.names = append(s.names, name)
+		s.pgMap[name] = pg
+		if _, ok := s.pgFiles[name]; !ok {
+			s.pgFiles[name] = s.programPath()
+		}
+		for _, proc := range s.newInstances(pg) {
+			s.procMap[proc.Name] = proc
+		}
+		s.broadcastEvent(programEvent(EventAdded, name))
 	}
 	return nil
 }
 
+// newInstances creates the process of every instance of the program
+func (s *Supervisor) newInstances(pg Program) []*Process {
+	ps := make([]*Process, 0, pg.numProcs())
+	for _, inst := range pg.Instances() {
+		p := s.newProcess(inst)
+		p.Parent = pg.ProgramName()
+		ps = append(ps, p)
+	}
+	return ps
+}
+
+// scaleInstancesLocked adds and removes instances to match numprocs of pg, the others keep
+// running. New instances are started if any instance of the program is running.
+// The caller holds s.mu.
+func (s *Supervisor) scaleInstancesLocked(name string, pg Program) {
+	origProcs := s.programProcsLocked(name)
+	isRunning := false
+	for _, proc := range origProcs {
+		isRunning = isRunning || isUp(proc.State())
+	}
+	keep := make(map[string]bool)
+	for _, inst := range pg.Instances() {
+		keep[inst.Name] = true
+		if _, ok := s.procMap[inst.Name]; ok {
+			continue
+		}
+		proc := s.newProcess(inst)
+		proc.Parent = name
+		s.procMap[proc.Name] = proc
+		s.broadcastEvent(programEvent(EventAdded, proc.Name))
+		if isRunning {
+			proc.Operate(StartEvent)
+		}
+	}
+	s.pgMap[name] = pg
+	for _, proc := range origProcs {
+		if keep[proc.Name] {
+			continue
+		}
+		delete(s.procMap, proc.Name)
+		s.broadcastEvent(programEvent(EventDeleted, proc.Name))
+		go s.stopProcess(proc)
+	}
+}
+
+// scaleProgram changes numprocs of the program and saves it
+func (s *Supervisor) scaleProgram(name string, numprocs int) (Program, error) {
+	pg, ok := s.program(name)
+	if !ok {
+		return pg, errNotFound("program %s not exists", strconv.Quote(name))
+	}
+	if numprocs < 1 {
+		return pg, errBadRequest("numprocs should be at least 1, got %d", numprocs)
+	}
+	pg.NumProcs = numprocs
+	if err := s.addOrUpdateProgram(pg); err != nil {
+		return pg, errBadRequest("%v", err)
+	}
+	return pg, s.saveDB()
+}
+
+// checkDependencies makes sure pg does not introduce unknown dependency or cycle
+func (s *Supervisor) checkDependencies(pg Program) error {
+	if len(pg.DependsOn) == 0 {
+		return nil
+	}
+	origPgs := s.programs()
+	pgs := make([]Program, 0, len(origPgs)+1)
+	for _, orig := range origPgs {
+		if orig.ProgramName() != pg.ProgramName() {
+			pgs = append(pgs, orig)
+		}
+	}
+	_, err := startOrder(append(pgs, pg))
+	return err
+}
+
 // Check
 // - Yaml format
-// - Duplicated program
-func (s *Supervisor) readConfigFromDB() (pgs []Program, err error) {
-	data, err := ioutil.ReadFile(s.programPath())
+// - Duplicated program, report both files it is defined in
+func (s *Supervisor) readConfigFromDB(files []string) (pgs []Program, sources map[string]string, err error) {
+	pgs = make([]Program, 0)
+	sources = make(map[string]string)
+	instances := make(map[string]string) // instance name -> program name
+	for _, file := range files {
+		filePgs, err := readProgramFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, pg := range filePgs {
+			name := pg.ProgramName()
+			if orig, ok := sources[name]; ok {
+				return nil, nil, fmt.Errorf("duplicated program name: %s in %s, already defined in %s", name, file, orig)
+			}
+			for _, instName := range pg.instanceNames() {
+				if other, ok := instances[instName]; ok {
+					return nil, nil, fmt.Errorf("duplicated process name: %s of %s in %s, already used by %s", instName, name, file, other)
+				}
+				instances[instName] = name
+			}
+			sources[name] = file
+			pgs = append(pgs, pg)
+		}
+	}
+	if _, err = startOrder(pgs); err != nil {
+		return nil, nil, err
+	}
+	return
+}
+
+func readProgramFile(file string) (pgs []Program, err error) {
+	data, err := ioutil.ReadFile(file)
 	if err != nil {
 		data = []byte("")
 	}
 	pgs = make([]Program, 0)
 	if err = yaml.Unmarshal(data, &pgs); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return pgs, nil
+}
+
+// checkConfig reads the program files and checks every program without applying them,
+// nothing is created or started
+func (s *Supervisor) checkConfig() error {
+	files, err := Cfg.ProgramFiles(s.ConfigDir)
+	if err != nil {
+		return err
+	}
+	pgs, sources, err := s.readConfigFromDB(files)
+	if err != nil {
+		return err
 	}
-	visited := map[string]bool{}
 	for _, pg := range pgs {
-		if visited[pg.Name] {
-			return nil, fmt.Errorf("duplicated program name: %s", pg.Name)
+		if err := pg.Check(); err != nil {
+			return fmt.Errorf("%s in %s: %v", pg.Name, sources[pg.ProgramName()], err)
 		}
-		visited[pg.Name] = true
 	}
-	return
+	return nil
 }
 
-func (s *Supervisor) loadDB() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	pgs, err := s.readConfigFromDB()
+// loadDB syncs programs with the program files and returns what changed.
+// With dryRun nothing is applied.
+func (s *Supervisor) loadDB(dryRun bool) (plan ReloadPlan, err error) {
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+	files, err := Cfg.ProgramFiles(s.ConfigDir)
 	if err != nil {
-		return err
+		return
+	}
+	pgs, sources, err := s.readConfigFromDB(files)
+	if err != nil {
+		return
+	}
+	if dryRun {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		plan = diffPrograms(s.names, s.pgMap, pgs)
+		plan.DryRun = true
+		return
+	}
+	s.mu.Lock()
+	removed := make(map[string][]*Process)
+	defer func() {
+		s.mu.Unlock()
+		for name, procs := range removed {
+			s.stopRemoved(name, procs)
+		}
+	}()
+	plan = diffPrograms(s.names, s.pgMap, pgs)
+	s.files = files
+	for name, file := range sources {
+		s.pgFiles[name] = file
 	}
 	// add or update program
 	visited := map[string]bool{}
 	names := make([]string, 0, len(pgs))
 	for _, pg := range pgs {
-		names = append(names, pg.Name)
-		visited[pg.Name] = true
-		s.addOrUpdateProgram(pg)
+		names = append(names, pg.ProgramName())
+		visited[pg.ProgramName()] = true
+		s.addOrUpdateProgramLocked(pg)
 	}
 	s.names = names
 	// delete not exists program
-	for _, pg := range s.pgMap {
-		if visited[pg.Name] {
+	for name := range s.pgMap {
+		if visited[name] {
 			continue
 		}
-		s.removeProgram(pg.Name)
+		removed[name] = s.removeProgramLocked(name)
 	}
-	return nil
+	return
 }
 
+// saveDB writes every program back to the file it was loaded from.
+// Files whose programs did not change are left untouched to keep comments.
 func (s *Supervisor) saveDB() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	data, err := yaml.Marshal(s.programs())
-	if err != nil {
-		return err
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+	groups := make(map[string][]Program)
+	s.mu.RLock()
+	files := append([]string{s.programPath()}, s.files...)
+	for _, pg := range s.programsLocked() {
+		file := s.pgFiles[pg.ProgramName()]
+		if file == "" {
+			file = s.programPath()
+		}
+		groups[file] = append(groups[file], pg)
+		files = append(files, file)
+	}
+	s.mu.RUnlock()
+	saved := map[string]bool{}
+	for _, file := range files {
+		if saved[file] {
+			continue
+		}
+		saved[file] = true
+		pgs := groups[file]
+		if orig, err := readProgramFile(file); err == nil && samePrograms(orig, pgs) {
+			continue
+		}
+		if pgs == nil {
+			pgs = []Program{}
+		}
+		data, err := yaml.Marshal(pgs)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(file, data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func samePrograms(a, b []Program) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
 	}
-	return ioutil.WriteFile(s.programPath(), data, 0644)
+	return reflect.DeepEqual(a, b)
 }
 
 func (s *Supervisor) removeProgram(name string) {
+	s.mu.Lock()
+	procs := s.removeProgramLocked(name)
+	s.mu.Unlock()
+	s.stopRemoved(name, procs)
+}
+
+// removeProgramLocked removes the program and returns its processes to stop,
+// the caller holds s.mu
+func (s *Supervisor) removeProgramLocked(name string) []*Process {
 	names := make([]string, 0, len(s.names))
 	for _, pName := range s.names {
 		if pName == name {
@@ -263,11 +675,22 @@ func (s *Supervisor) removeProgram(name string) {
 		names = append(names, pName)
 	}
 	s.names = names
-	log.Infof("stop before delete program: %s", name)
-	s.stopAndWait(name)
-	delete(s.procMap, name)
+	procs := s.programProcsLocked(name)
+	for _, proc := range procs {
+		delete(s.procMap, proc.Name)
+	}
 	delete(s.pgMap, name)
-	s.broadcastEvent(name + " deleted")
+	delete(s.pgFiles, name)
+	return procs
+}
+
+// stopRemoved stops the processes of the removed program
+func (s *Supervisor) stopRemoved(name string, procs []*Process) {
+	log.Infof("stop before delete program: %s", name)
+	for _, proc := range procs {
+		s.stopProcess(proc)
+	}
+	s.broadcastEvent(programEvent(EventDeleted, name))
 }
 
 type WebConfig struct {
@@ -331,6 +754,7 @@ func (s *Supervisor) hShutdown(w http.ResponseWriter, r *http.Request) {
 
 	//s.CloseAndCleanWithLock()
 
+	s.recordAction(r, "shutdown", "")
 	s.Close()
 	s.CleanFile()
 
@@ -345,12 +769,16 @@ func (s *Supervisor) hShutdown(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Supervisor) hReload(w http.ResponseWriter, r *http.Request) {
-	err := s.loadDB()
-	log.Info("reload config file")
+	dryRun, _ := strconv.ParseBool(r.FormValue("dry_run"))
+	if !dryRun {
+		s.recordAction(r, "reload", "")
+	}
+	plan, err := s.loadDB(dryRun)
+	log.Infof("reload config file, dry run: %v", dryRun)
 	if err == nil {
 		s.renderJSON(w, JSONResponse{
 			Status: 0,
-			Value:  "load config success",
+			Value:  plan,
 		})
 	} else {
 		s.renderJSON(w, JSONResponse{
@@ -360,8 +788,14 @@ func (s *Supervisor) hReload(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// hGetProgramList lists programs, query group and selector filter by group and labels
 func (s *Supervisor) hGetProgramList(w http.ResponseWriter, r *http.Request) {
-	data, err := json.Marshal(s.procs())
+	procs, err := s.filterProcs(r.FormValue("group"), r.FormValue("selector"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data, err := json.Marshal(procs)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -371,12 +805,11 @@ func (s *Supervisor) hGetProgramList(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Supervisor) hGetProgram(w http.ResponseWriter, r *http.Request) {
-	name := mux.Vars(r)["name"]
-	proc, ok := s.procMap[name]
-	if !ok {
+	proc, err := s.lookupProcess(mux.Vars(r)["name"])
+	if err != nil {
 		s.renderJSON(w, JSONResponse{
 			Status: 1,
-			Value:  "program not exists",
+			Value:  err.Error(),
 		})
 		return
 	} else {
@@ -408,13 +841,17 @@ func (s *Supervisor) hAddProgram(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if err := s.checkDependencies(pg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	var data []byte
-	if _, ok := s.pgMap[pg.Name]; ok {
+	if _, ok := s.program(pg.ProgramName()); ok {
 		data, _ = json.Marshal(map[string]interface{}{
 			"status": 1,
-			"error":  fmt.Sprintf("Program %s already exists", strconv.Quote(pg.Name)),
+			"error":  fmt.Sprintf("Program %s already exists", strconv.Quote(pg.ProgramName())),
 		})
 	} else {
 		if err := s.addOrUpdateProgram(pg); err != nil {
@@ -444,7 +881,10 @@ func (s *Supervisor) hUpdateProgram(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	err = s.addOrUpdateProgram(pg)
+	err = s.checkDependencies(pg)
+	if err == nil {
+		err = s.addOrUpdateProgram(pg)
+	}
 	if err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"status": 2,
@@ -452,6 +892,7 @@ func (s *Supervisor) hUpdateProgram(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	s.saveDB()
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status":      0,
 		"description": "program updated",
@@ -463,7 +904,7 @@ func (s *Supervisor) hDelProgram(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	var data []byte
-	if _, ok := s.pgMap[name]; !ok {
+	if _, ok := s.program(name); !ok {
 		data, _ = json.Marshal(map[string]interface{}{
 			"status": 1,
 			"error":  fmt.Sprintf("Program %s not exists", strconv.Quote(name)),
@@ -478,83 +919,297 @@ func (s *Supervisor) hDelProgram(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
-func (s *Supervisor) hStartProgram(w http.ResponseWriter, r *http.Request) {
+// hScaleProgram changes numprocs of the program to form numprocs
+func (s *Supervisor) hScaleProgram(w http.ResponseWriter, r *http.Request) {
 	name := mux.Vars(r)["name"]
-	proc, ok := s.procMap[name]
-	var data []byte
-	if !ok {
-		data, _ = json.Marshal(map[string]interface{}{
-			"status": 1,
-			"error":  fmt.Sprintf("Process %s not exists", strconv.Quote(name)),
+	numprocs, err := strconv.Atoi(r.FormValue("numprocs"))
+	if err != nil {
+		s.renderJSON(w, JSONResponse{
+			Status: 1,
+			Value:  "numprocs should be integer",
 		})
-	} else {
-		proc.Operate(StartEvent)
-		data, _ = json.Marshal(map[string]interface{}{
-			"status": 0,
-			"name":   name,
+		return
+	}
+	s.recordAction(r, fmt.Sprintf("scale %d", numprocs), name)
+	if _, err := s.scaleProgram(name, numprocs); err != nil {
+		s.renderJSON(w, JSONResponse{
+			Status: 1,
+			Value:  err.Error(),
+		})
+		return
+	}
+	s.renderJSON(w, JSONResponse{
+		Status: 0,
+		Value:  fmt.Sprintf("%s scaled to %d", name, numprocs),
+	})
+}
+
+// hOperatePrograms starts, stops, restarts or signals the programs, name can be all or a glob pattern,
+// form group and selector filter by group and labels, form signal is for signal,
+// form rolling=true and batch=N for rolling restart. Value is the result of every program.
+func (s *Supervisor) hOperatePrograms(op string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var sig syscall.Signal
+		var err error
+		if op == OpSignal {
+			sig, err = parseSignal(r.FormValue("signal"))
+		}
+		var procs []*Process
+		if err == nil {
+			procs, err = s.selectProcs(mux.Vars(r)["name"], r.FormValue("group"), r.FormValue("selector"))
+		}
+		if err != nil {
+			s.renderJSON(w, JSONResponse{
+				Status: 1,
+				Value:  err.Error(),
+			})
+			return
+		}
+		var results []OperateResult
+		if rolling, _ := strconv.ParseBool(r.FormValue("rolling")); op == OpRestart && rolling {
+			batch, _ := strconv.Atoi(r.FormValue("batch"))
+			results = s.operateRolling(r, procs, batch)
+		} else {
+			results = s.operate(r, op, procs, sig)
+		}
+		status := 0
+		for _, result := range results {
+			if !result.OK {
+				status = 1
+			}
+		}
+		s.renderJSON(w, JSONResponse{
+			Status: status,
+			Value:  results,
+		})
+	}
+}
+
+func (s *Supervisor) hGetProgramRuns(w http.ResponseWriter, r *http.Request) {
+	proc, err := s.lookupProcess(mux.Vars(r)["name"])
+	if err != nil {
+		s.renderJSON(w, JSONResponse{
+			Status: 1,
+			Value:  err.Error(),
 		})
+		return
+	}
+	limit, err := strconv.Atoi(r.FormValue("limit"))
+	if err != nil {
+		limit = 20
+	}
+	runs, err := proc.Runs(limit)
+	if err != nil {
+		s.renderJSON(w, JSONResponse{
+			Status: 1,
+			Value:  err.Error(),
+		})
+		return
+	}
+	s.renderJSON(w, JSONResponse{
+		Status: 0,
+		Value:  runs,
+	})
+}
+
+func (s *Supervisor) hGetProgramDeploys(w http.ResponseWriter, r *http.Request) {
+	proc, err := s.lookupProcess(mux.Vars(r)["name"])
+	if err != nil {
+		s.renderJSON(w, JSONResponse{
+			Status: 1,
+			Value:  err.Error(),
+		})
+		return
+	}
+	limit, err := strconv.Atoi(r.FormValue("limit"))
+	if err != nil {
+		limit = 20
+	}
+	deploys, err := s.Deploys(proc, limit)
+	if err != nil {
+		s.renderJSON(w, JSONResponse{
+			Status: 1,
+			Value:  err.Error(),
+		})
+		return
+	}
+	s.renderJSON(w, JSONResponse{
+		Status: 0,
+		Value:  deploys,
+	})
+}
+
+// hGetDeployLog returns the output of the deploy as text/plain
+func (s *Supervisor) hGetDeployLog(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	proc, ok := s.process(vars["name"])
+	if !ok {
+		http.Error(w, fmt.Sprintf("proc %s not exist", strconv.Quote(vars["name"])), http.StatusNotFound)
+		return
+	}
+	data, err := DeployLog(proc, vars["id"])
+	if os.IsNotExist(err) {
+		http.Error(w, "deploy log not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.Write(data)
 }
 
-func (s *Supervisor) hStopProgram(w http.ResponseWriter, r *http.Request) {
+// hGetProgramLog reads the log file as text/plain
+// - lines: last N lines including the rotated files, default 100
+// - offset: read from the byte offset of current log file instead, X-Log-Offset header is the next offset
+// - stream: stdout(default) or stderr
+// - follow: keep sending new content
+func (s *Supervisor) hGetProgramLog(w http.ResponseWriter, r *http.Request) {
 	name := mux.Vars(r)["name"]
-	proc, ok := s.procMap[name]
-	var data []byte
+	proc, ok := s.process(name)
 	if !ok {
-		data, _ = json.Marshal(map[string]interface{}{
-			"status": 1,
-			"error":  fmt.Sprintf("Process %s not exists", strconv.Quote(name)),
-		})
+		http.Error(w, fmt.Sprintf("Process %s not exists", strconv.Quote(name)), http.StatusNotFound)
+		return
+	}
+	filename := proc.StdoutLogPath()
+	switch r.FormValue("stream") {
+	case "", "stdout":
+	case "stderr":
+		filename = proc.StderrLogPath()
+	default:
+		http.Error(w, "stream should be stdout or stderr", http.StatusBadRequest)
+		return
+	}
+
+	var data []byte
+	var offset int64
+	var err error
+	if r.FormValue("offset") != "" {
+		offset, err = strconv.ParseInt(r.FormValue("offset"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid offset", http.StatusBadRequest)
+			return
+		}
+		data, offset, err = readLogFrom(filename, offset)
 	} else {
-		proc.Operate(StopEvent)
-		data, _ = json.Marshal(map[string]interface{}{
-			"status": 0,
-			"name":   name,
-		})
+		lines, _ := strconv.Atoi(r.FormValue("lines"))
+		if lines <= 0 {
+			lines = 100
+		}
+		if fi, serr := os.Stat(filename); serr == nil {
+			offset = fi.Size()
+		}
+		data, err = tailLines(filename, lines)
 	}
+	if err != nil && !os.IsNotExist(err) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Log-Offset", strconv.FormatInt(offset, 10))
 	w.Write(data)
+
+	if follow, _ := strconv.ParseBool(r.FormValue("follow")); follow {
+		followLog(w, r, filename, offset)
+	}
+}
+
+func (s *Supervisor) hGetSilences(w http.ResponseWriter, r *http.Request) {
+	s.renderJSON(w, JSONResponse{
+		Status: 0,
+		Value:  s.silences.List(),
+	})
+}
+
+// hAddSilence creates a silence, form: program, duration(eg: 2h30m), comment
+func (s *Supervisor) hAddSilence(w http.ResponseWriter, r *http.Request) {
+	duration, err := time.ParseDuration(r.FormValue("duration"))
+	if err != nil {
+		s.renderJSON(w, JSONResponse{
+			Status: 1,
+			Value:  fmt.Sprintf("invalid duration: %v", err),
+		})
+		return
+	}
+	program := r.FormValue("program")
+	if program == "" {
+		s.renderJSON(w, JSONResponse{
+			Status: 1,
+			Value:  "program required, use * to silence all programs",
+		})
+		return
+	}
+	silence, err := s.silences.Add(program, duration, r.FormValue("comment"))
+	if err == nil {
+		s.recordAction(r, "silence "+duration.String(), program)
+	}
+	if err != nil {
+		s.renderJSON(w, JSONResponse{
+			Status: 1,
+			Value:  err.Error(),
+		})
+		return
+	}
+	s.renderJSON(w, JSONResponse{
+		Status: 0,
+		Value:  silence,
+	})
+}
+
+func (s *Supervisor) hDelSilence(w http.ResponseWriter, r *http.Request) {
+	if err := s.silences.Remove(mux.Vars(r)["id"]); err != nil {
+		s.renderJSON(w, JSONResponse{
+			Status: 1,
+			Value:  err.Error(),
+		})
+		return
+	}
+	s.recordAction(r, "unsilence "+mux.Vars(r)["id"], "")
+	s.renderJSON(w, JSONResponse{
+		Status: 0,
+	})
 }
 
 func (s *Supervisor) hWebhook(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	name, category := vars["name"], vars["category"]
-	proc, ok := s.procMap[name]
+	proc, ok := s.process(name)
 	if !ok {
 		http.Error(w, fmt.Sprintf("proc %s not exist", strconv.Quote(name)), http.StatusForbidden)
 		return
 	}
 	hook := proc.Program.WebHook
-	if category == "github" {
-		gh := hook.Github
-		_ = gh.Secret
-		isRunning := proc.IsRunning()
-		s.stopAndWait(name)
-		go func() {
-			cmd := kexec.CommandString(hook.Command)
-			cmd.Dir = proc.Program.Dir
-			cmd.Stdout = proc.Output
-			cmd.Stderr = proc.Output
-			err := GoTimeout(cmd.Run, time.Duration(hook.Timeout)*time.Second)
-			if err == ErrGoTimeout {
-				cmd.Terminate(syscall.SIGTERM)
-			}
-			if err != nil {
-				log.Warnf("webhook command error: %v", err)
-				// Trigger pushover notification
-			}
-			if isRunning {
-				proc.Operate(StartEvent)
-			}
-		}()
-		io.WriteString(w, "success triggered")
-	} else {
-		log.Warnf("unknown webhook category: %v", category)
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 10<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := hook.Verify(category, r.Header, body); err != nil {
+		log.Warnf("webhook %s of %s rejected: %v", category, name, err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
 	}
+	if r.Header.Get("X-GitHub-Event") == "ping" {
+		io.WriteString(w, "pong")
+		return
+	}
+	ref := hookRef(body)
+	if category == HookGeneric && r.URL.Query().Get("ref") != "" {
+		ref = r.URL.Query().Get("ref")
+	}
+	if !hook.MatchRef(ref) {
+		io.WriteString(w, fmt.Sprintf("skipped, ref %s not in branches %v", strconv.Quote(ref), hook.Branches))
+		return
+	}
+	s.recordAction(r, "webhook "+category, name)
+	deploy := s.triggerDeploy(name, category, ref)
+	io.WriteString(w, fmt.Sprintf("deploy %s %s", deploy.ID, deploy.Status))
 }
 
 var upgrader = websocket.Upgrader{}
 
+// wsEvents sends every Event as json
 func (s *Supervisor) wsEvents(w http.ResponseWriter, r *http.Request) {
 	c, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -563,35 +1218,120 @@ func (s *Supervisor) wsEvents(w http.ResponseWriter, r *http.Request) {
 	}
 	defer c.Close()
 
-	ch := make(chan string, 0)
-	s.addStatusChangeListener(ch)
+	reader := s.newEventReader(r)
+	defer reader.Close()
 	go func() {
-		_, _ = <-ch // ignore the history messages
-		for message := range ch {
-			// Question: type 1 ?
-			c.WriteMessage(1, []byte(message))
+		// nothing expected from the client, stop when it goes away
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				reader.Close()
+				return
+			}
 		}
-		// s.eventB.RemoveListener(ch)
 	}()
 	for {
-		mt, message, err := c.ReadMessage()
-		if err != nil {
-			log.Info("read:", mt, err)
-			break
+		event, ok := reader.Next()
+		if !ok {
+			return
 		}
-		log.Info("recv: %v %s", mt, message)
-		err = c.WriteMessage(mt, message)
-		if err != nil {
-			log.Info("write:", err)
-			break
+		if err := c.WriteJSON(event); err != nil {
+			return
 		}
 	}
 }
 
+// hGetEvents queries the event history, params: program, type, since, until(RFC3339 or duration before now, eg: 2h), limit
+func (s *Supervisor) hGetEvents(w http.ResponseWriter, r *http.Request) {
+	q := EventQuery{
+		Program: r.FormValue("program"),
+		Type:    r.FormValue("type"),
+	}
+	var err error
+	if q.Since, err = parseTimeArg(r.FormValue("since")); err == nil {
+		q.Until, err = parseTimeArg(r.FormValue("until"))
+	}
+	if err != nil {
+		s.renderJSON(w, JSONResponse{
+			Status: 1,
+			Value:  err.Error(),
+		})
+		return
+	}
+	if q.Limit, err = strconv.Atoi(r.FormValue("limit")); err != nil {
+		q.Limit = 100
+	}
+	events, err := s.eventStore.Query(q)
+	if err != nil {
+		s.renderJSON(w, JSONResponse{
+			Status: 1,
+			Value:  err.Error(),
+		})
+		return
+	}
+	s.renderJSON(w, JSONResponse{
+		Status: 0,
+		Value:  events,
+	})
+}
+
+// hEventStream sends the events as Server-Sent Events, the seq is the event id
+// so a reconnected EventSource resumes by the header Last-Event-ID
+func (s *Supervisor) hEventStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher.Flush()
+
+	reader := s.newEventReader(r)
+	defer reader.Close()
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		for {
+			event, ok := reader.Next()
+			if !ok {
+				return
+			}
+			select {
+			case events <- event:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}()
+
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(event)
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Seq, event.Type, data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
 func (s *Supervisor) wsLog(w http.ResponseWriter, r *http.Request) {
 	name := mux.Vars(r)["name"]
 	log.Info(name)
-	proc, ok := s.procMap[name]
+	proc, ok := s.process(name)
 	if !ok {
 		log.Info("No such process")
 		// TODO: raise error here?
@@ -605,10 +1345,36 @@ func (s *Supervisor) wsLog(w http.ResponseWriter, r *http.Request) {
 	}
 	defer c.Close()
 
-	for data := range proc.Output.NewChanString(r.RemoteAddr) {
-		err := c.WriteMessage(1, []byte(data))
+	// stream: stdout, stderr or both by default
+	stream := r.FormValue("stream")
+	if stream != "stdout" && stream != "stderr" {
+		stream = ""
+	}
+	// format=json sends every line as a LogLine, seq=N resumes after line N
+	jsonFormat := r.FormValue("format") == "json"
+	afterSeq, _ := strconv.ParseUint(r.FormValue("seq"), 10, 64)
+	sub := proc.Output.Subscribe(afterSeq, stream)
+	defer sub.Close()
+	go func() {
+		// stop sending when the client goes away
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				sub.Close()
+				return
+			}
+		}
+	}()
+	for {
+		line, ok := sub.Next()
+		if !ok {
+			break
+		}
+		if jsonFormat {
+			err = c.WriteJSON(line)
+		} else {
+			err = c.WriteMessage(1, []byte(line.Text+"\n"))
+		}
 		if err != nil {
-			proc.Output.CloseWriter(r.RemoteAddr)
 			break
 		}
 	}
@@ -624,7 +1390,7 @@ func (s *Supervisor) wsPerf(w http.ResponseWriter, r *http.Request) {
 	defer c.Close()
 
 	name := mux.Vars(r)["name"]
-	proc, ok := s.procMap[name]
+	proc, ok := s.process(name)
 	if !ok {
 		log.Info("No such process")
 		// TODO: raise error here?
@@ -632,12 +1398,11 @@ func (s *Supervisor) wsPerf(w http.ResponseWriter, r *http.Request) {
 	}
 	for {
 		// c.SetWriteDeadline(time.Now().Add(3 * time.Second))
-		if proc.cmd == nil || proc.cmd.Process == nil {
+		if !isUp(proc.State()) {
 			log.Info("process not running")
 			return
 		}
-		pid := proc.cmd.Process.Pid
-		ps, err := gops.NewProcess(pid)
+		ps, err := gops.NewProcess(proc.pid())
 		if err != nil {
 			break
 		}
@@ -656,8 +1421,11 @@ func (s *Supervisor) wsPerf(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Close stops programs in reverse start order
 func (s *Supervisor) Close() {
-	for _, proc := range s.procMap {
+	procs := s.orderedProcs()
+	for i := len(procs) - 1; i >= 0; i-- {
+		proc := procs[i]
 		if err := s.stopAndWait(proc.Name); err != nil {
 			log.Warnf("[%s] program stop  failed.", proc.Name)
 		} else {
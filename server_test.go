@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// newTestSupervisor returns a supervisor with pgs added, programs are saved in dir
+func newTestSupervisor(dir string, pgs ...Program) *Supervisor {
+	s := &Supervisor{
+		ConfigDir: dir,
+		pgMap:     make(map[string]Program),
+		pgFiles:   make(map[string]string),
+		procMap:   make(map[string]*Process),
+		eventB:    NewWriteBroadcaster(4096),
+	}
+	for _, pg := range pgs {
+		So(s.addOrUpdateProgram(pg), ShouldBeNil)
+	}
+	return s
+}
+
+func TestCheckConfig(t *testing.T) {
+	Convey("Config test should check programs without creating anything", t, func() {
+		dir, err := ioutil.TempDir("", "gosuv")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		programFile := filepath.Join(dir, DefaultProgramFile)
+
+		So(ioutil.WriteFile(programFile, []byte("- name: web\n  command: sleep 10\n"), 0644), ShouldBeNil)
+		s := &Supervisor{ConfigDir: dir}
+		So(s.checkConfig(), ShouldBeNil)
+		files, _ := ioutil.ReadDir(dir)
+		So(len(files), ShouldEqual, 1)
+
+		So(ioutil.WriteFile(programFile, []byte("- name: web\n"), 0644), ShouldBeNil)
+		err = s.checkConfig()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "web in "+programFile)
+	})
+}
+
+func TestAddSilence(t *testing.T) {
+	Convey("Bad silences should be answered with status 1", t, func() {
+		dir, err := ioutil.TempDir("", "gosuv")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		s := newTestSupervisor(dir)
+		s.silences, err = NewSilenceStore(filepath.Join(dir, DefaultSilenceFile))
+		So(err, ShouldBeNil)
+
+		add := func(form string) JSONResponse {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "/api/silences", strings.NewReader(form))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			s.hAddSilence(w, r)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			var ret JSONResponse
+			So(json.Unmarshal(w.Body.Bytes(), &ret), ShouldBeNil)
+			return ret
+		}
+		So(add("duration=1h").Status, ShouldEqual, 1)
+		So(add("duration=1h").Value, ShouldContainSubstring, "program required")
+		So(add("program=web&duration=forever").Status, ShouldEqual, 1)
+		So(add("program=*&duration=1h").Status, ShouldEqual, 0)
+	})
+}
@@ -10,8 +10,12 @@ import (
 	log "github.com/cihub/seelog"
 )
 
+// Orphaned processes are only reparented to gosuv when it runs as pid 1 (eg: in docker).
+// Otherwise every child is waited by exec.Cmd, and reaping here would steal their exit status.
 func init() {
-	go watchChildSignal()
+	if os.Getpid() == 1 {
+		go watchChildSignal()
+	}
 }
 
 func watchChildSignal() {
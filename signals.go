@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var signalNames = map[string]syscall.Signal{
+	"HUP":   syscall.SIGHUP,
+	"INT":   syscall.SIGINT,
+	"QUIT":  syscall.SIGQUIT,
+	"KILL":  syscall.SIGKILL,
+	"USR1":  syscall.SIGUSR1,
+	"USR2":  syscall.SIGUSR2,
+	"TERM":  syscall.SIGTERM,
+	"CONT":  syscall.SIGCONT,
+	"STOP":  syscall.SIGSTOP,
+	"WINCH": syscall.SIGWINCH,
+}
+
+// parseSignal accepts names like TERM, SIGTERM, term or a number like 15
+func parseSignal(name string) (syscall.Signal, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if n, err := strconv.Atoi(name); err == nil && n > 0 {
+		return syscall.Signal(n), nil
+	}
+	if sig, ok := signalNames[strings.TrimPrefix(name, "SIG")]; ok {
+		return sig, nil
+	}
+	return 0, fmt.Errorf("unknown signal: %s", strconv.Quote(name))
+}
+
+// StopStep sends Signal and then waits up to Wait seconds for the program to quit
+type StopStep struct {
+	Signal string `yaml:"signal" json:"signal"`
+	Wait   int    `yaml:"wait" json:"wait"`
+}
+
+// stopSteps returns the stop sequence of the program.
+// Without stop_sequence it is stop_signal (default TERM) then wait stop_timeout.
+// SIGKILL is always sent to the whole process group when all the steps are done.
+func (p *Program) stopSteps() []StopStep {
+	if len(p.StopSequence) > 0 {
+		return p.StopSequence
+	}
+	sig := p.StopSignal
+	if sig == "" {
+		sig = "TERM"
+	}
+	return []StopStep{{Signal: sig, Wait: p.StopTimeout}}
+}
+
+// Signal sends sig to the running program
+func (p *Process) Signal(sig syscall.Signal) error {
+	if !isUp(p.State()) {
+		return fmt.Errorf("program is %s, not running", p.State())
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cmd == nil || p.cmd.Process == nil {
+		return fmt.Errorf("program is %s, not running", p.State())
+	}
+	return p.cmd.Process.Signal(sig)
+}
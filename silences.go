@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/facebookgo/atomicfile"
+)
+
+const DefaultSilenceFile = "silences.json"
+
+var errSilenceNotExist = errors.New("silence not exists")
+
+// Silence suppresses the notifications of programs until the time is up
+type Silence struct {
+	ID      string    `json:"id"`
+	Program string    `json:"program"` // program name or glob pattern, eg: * or web-*
+	Until   time.Time `json:"until"`
+	Comment string    `json:"comment,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+func (s Silence) Match(name string, now time.Time) bool {
+	if now.After(s.Until) {
+		return false
+	}
+	ok, _ := filepath.Match(s.Program, name)
+	return ok
+}
+
+// SilenceStore keeps the silences in a json file so they survive a restart
+type SilenceStore struct {
+	mu       sync.Mutex
+	file     string
+	silences []Silence
+}
+
+func NewSilenceStore(file string) (*SilenceStore, error) {
+	ss := &SilenceStore{file: file}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return ss, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &ss.silences); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return ss, nil
+}
+
+// save writes the silences not expired yet
+func (ss *SilenceStore) save() error {
+	now := time.Now()
+	active := make([]Silence, 0, len(ss.silences))
+	for _, s := range ss.silences {
+		if now.Before(s.Until) {
+			active = append(active, s)
+		}
+	}
+	ss.silences = active
+	if ss.file == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(ss.silences, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := atomicfile.New(ss.file, os.FileMode(0644))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		file.Abort()
+		return err
+	}
+	return file.Close()
+}
+
+// Add creates a silence of program for duration
+func (ss *SilenceStore) Add(program string, duration time.Duration, comment string) (Silence, error) {
+	if _, err := filepath.Match(program, ""); err != nil {
+		return Silence{}, fmt.Errorf("invalid program pattern %s: %v", program, err)
+	}
+	if duration <= 0 {
+		return Silence{}, fmt.Errorf("duration should be positive, got %v", duration)
+	}
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	now := time.Now()
+	s := Silence{
+		ID:      fmt.Sprintf("%x", now.UnixNano()),
+		Program: program,
+		Until:   now.Add(duration),
+		Comment: comment,
+		Created: now,
+	}
+	ss.silences = append(ss.silences, s)
+	return s, ss.save()
+}
+
+// Remove expires the silence at once
+func (ss *SilenceStore) Remove(id string) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for i, s := range ss.silences {
+		if s.ID == id {
+			ss.silences = append(ss.silences[:i], ss.silences[i+1:]...)
+			return ss.save()
+		}
+	}
+	return errSilenceNotExist
+}
+
+// List returns the silences not expired yet
+func (ss *SilenceStore) List() []Silence {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	now := time.Now()
+	silences := make([]Silence, 0, len(ss.silences))
+	for _, s := range ss.silences {
+		if now.Before(s.Until) {
+			silences = append(silences, s)
+		}
+	}
+	return silences
+}
+
+func (ss *SilenceStore) Silenced(name string) bool {
+	now := time.Now()
+	for _, s := range ss.List() {
+		if s.Match(name, now) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package slack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+type apiRequest struct {
+	Text     string `json:"text"`
+	Channel  string `json:"channel,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+type Params struct {
+	URL      string // incoming webhook url
+	Channel  string // optional, override the default channel of the webhook
+	Username string
+	Title    string
+	Message  string
+}
+
+// Notify posts a message to a Slack compatible incoming webhook.
+func Notify(n Params) error {
+	payload := new(bytes.Buffer)
+	err := json.NewEncoder(payload).Encode(apiRequest{
+		Text:     fmt.Sprintf("*%s*\n%s", n.Title, n.Message),
+		Channel:  n.Channel,
+		Username: n.Username,
+	})
+	if err != nil {
+		return err
+	}
+
+	webClient := &http.Client{Timeout: 30 * time.Second}
+	resp, err := webClient.Post(n.URL, "application/json", payload)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("site: %s, status: %d, msg: %s", "slack", resp.StatusCode, body)
+	}
+	return nil
+}
@@ -23,6 +23,11 @@ var (
 
 type Program struct {
 	Name          string   `yaml:"name" json:"name"`
+	Labels        map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"` // eg: team: payments, see Selector
+	Group         string   `yaml:"group,omitempty" json:"group,omitempty"`
+	NumProcs      int      `yaml:"numprocs,omitempty" json:"numprocs,omitempty"` // instances, name should contain %(process_num) if more than 1
+	NumProcsStart int      `yaml:"numprocs_start,omitempty" json:"numprocsStart,omitempty"` // first %(process_num), default 0
+	RollingBatch  int      `yaml:"rolling_batch,omitempty" json:"rollingBatch,omitempty"` // instances restarted at a time when definition changes, default 1
 	Command       string   `yaml:"command" json:"command"`
 	Environ       []string `yaml:"environ" json:"environ"`
 	Dir           string   `yaml:"directory" json:"directory"`
@@ -30,20 +35,39 @@ type Program struct {
 	StartRetries  int      `yaml:"start_retries" json:"startRetries"`
 	StartSeconds  int      `yaml:"start_seconds,omitempty" json:"startSeconds"`
 	StopTimeout   int      `yaml:"stop_timeout,omitempty" json:"stopTimeout"`
+	StopSignal    string     `yaml:"stop_signal,omitempty" json:"stopSignal"`
+	StopSequence  []StopStep `yaml:"stop_sequence,omitempty" json:"stopSequence"`
+	ExitCodes     []int       `yaml:"exitcodes,omitempty" json:"exitCodes"`     // expected exit codes, default [0]
+	AutoRestart   AutoRestart `yaml:"autorestart,omitempty" json:"autoRestart"` // true, false or unexpected(default)
+	Type          string      `yaml:"type,omitempty" json:"type"`         // daemon(default), oneshot or eventlistener
+	Events        []string    `yaml:"events,omitempty" json:"events"`     // events sent to eventlistener, eg: PROCESS_STATE
+	Schedule      string      `yaml:"schedule,omitempty" json:"schedule"` // crontab expression, eg: */5 * * * *
+	DependsOn     []string    `yaml:"depends_on,omitempty" json:"dependsOn"`
+	Priority      int         `yaml:"priority,omitempty" json:"priority"` // lower starts first and stops last
+	HealthCheck   HealthCheck `yaml:"healthcheck,omitempty" json:"healthcheck"`
+	StdoutLogfile   string      `yaml:"stdout_logfile,omitempty" json:"stdoutLogfile"` // default <logpath>/<name>/output.log
+	StderrLogfile   string      `yaml:"stderr_logfile,omitempty" json:"stderrLogfile"` // default <logpath>/<name>/stderr.log
+	RedirectStderr  bool        `yaml:"redirect_stderr,omitempty" json:"redirectStderr"`
+	LogRotate       LogRotate   `yaml:"log_rotate,omitempty" json:"logRotate"`               // for stdout, and stderr if stderr_log_rotate not set
+	StderrLogRotate LogRotate   `yaml:"stderr_log_rotate,omitempty" json:"stderrLogRotate"`
 	User          string   `yaml:"user,omitempty" json:"user"`
 	LogDisable    bool     `yaml:"log_disable" json:"log_disable"`
 	StderrOnly    bool    `yaml:"stderr_only,omitempty" json:"stderr_only"`
-	Notifications struct {
-		Pushover struct {
-			ApiKey string   `yaml:"api_key"`
-			Users  []string `yaml:"users"`
-		} `yaml:"pushover,omitempty"`
-	} `yaml:"notifications,omitempty" json:"-"`
-	WebHook struct {
-		Github struct {
-			Secret string `yaml:"secret"`
-		} `yaml:"github"`
-		Command string `yaml:"command"`
-		Timeout int    `yaml:"timeout"`
-	} `yaml:"webhook,omitempty" json:"-"`
+	Backoff       Backoff  `yaml:"backoff,omitempty" json:"backoff"`
+	HealthyUptime int      `yaml:"healthy_uptime,omitempty" json:"healthyUptime"` // seconds running before retries reset
+	Notifications Notifications `yaml:"notifications,omitempty" json:"-"`
+	WebHook       WebHook       `yaml:"webhook,omitempty" json:"-"`
+}
+
+// Notifications configures the channels and which state changes notify them
+type Notifications struct {
+	Pushover PushoverNotifier `yaml:"pushover,omitempty"`
+	Hipchat  HipchatNotifier  `yaml:"hipchat,omitempty"`
+	Webhook  WebhookNotifier  `yaml:"webhook,omitempty"`
+	Email    EmailNotifier    `yaml:"email,omitempty"`
+	Slack    SlackNotifier    `yaml:"slack,omitempty"`
+	// event(fatal, restarted, exited, unhealthy) -> channels, default fatal to all channels
+	Triggers map[string][]string `yaml:"triggers,omitempty"`
+	Title    string              `yaml:"title,omitempty"`   // go template, default DefaultNotifyTitle
+	Message  string              `yaml:"message,omitempty"` // go template, default DefaultNotifyMessage
 }
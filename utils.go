@@ -6,14 +6,23 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 	//"os/exec"
 
 	log "github.com/cihub/seelog"
+	"github.com/codeskyblue/kexec"
 )
 
-var ErrGoTimeout = errors.New("GoTimeoutFunc")
+var (
+	ErrGoTimeout      = errors.New("GoTimeoutFunc")
+	ErrCommandTimeout = errors.New("command timed out")
+)
+
+// killWait is how long a timed out command has to quit before SIGKILL
+const killWait = 5 * time.Second
 
 func GoFunc(f func() error) chan error {
 	ch := make(chan error)
@@ -52,6 +61,32 @@ func GoTimeout(f func() error, timeout time.Duration) (err error) {
 	}
 }
 
+// runTimeout runs cmd and sends sig to its process group after timeout,
+// SIGKILL if still running killWait later. It returns after cmd is waited,
+// ErrCommandTimeout if timed out.
+func runTimeout(cmd *kexec.KCommand, timeout time.Duration, sig syscall.Signal) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	waitC := GoFunc(cmd.Wait)
+	select {
+	case err := <-waitC:
+		return err
+	case <-time.After(timeout):
+	}
+	cmd.Terminate(sig)
+	if sig != syscall.SIGKILL {
+		select {
+		case <-waitC:
+			return ErrCommandTimeout
+		case <-time.After(killWait):
+		}
+		cmd.Terminate(syscall.SIGKILL)
+	}
+	<-waitC
+	return ErrCommandTimeout
+}
+
 func IsDir(dir string) bool {
 	fi, err := os.Stat(dir)
 	return err == nil && fi.IsDir()
@@ -125,3 +160,26 @@ func getExecPath() string {
 	ex, _ := os.Executable()
 	return filepath.Dir(ex)
 }
+
+// parseSize parses size like 1024, 10K, 10KB, 50MB, 1G
+func parseSize(s string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	str = strings.TrimSuffix(str, "B")
+	unit := int64(1)
+	switch {
+	case strings.HasSuffix(str, "K"):
+		unit = 1 << 10
+	case strings.HasSuffix(str, "M"):
+		unit = 1 << 20
+	case strings.HasSuffix(str, "G"):
+		unit = 1 << 30
+	}
+	if unit > 1 {
+		str = str[:len(str)-1]
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(str), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %s", strconv.Quote(s))
+	}
+	return n * unit, nil
+}
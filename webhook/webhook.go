@@ -0,0 +1,46 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+type Params struct {
+	URL     string
+	Headers map[string]string
+	Data    interface{} // sent as json
+}
+
+// Notify posts Data as json to the URL, any 2xx status is a success.
+func Notify(n Params) error {
+	payload := new(bytes.Buffer)
+	if err := json.NewEncoder(payload).Encode(n.Data); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", n.URL, payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range n.Headers {
+		req.Header.Set(key, value)
+	}
+
+	webClient := &http.Client{Timeout: 30 * time.Second}
+	resp, err := webClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("site: %s, status: %d, msg: %s", n.URL, resp.StatusCode, body)
+	}
+	return nil
+}